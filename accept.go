@@ -0,0 +1,188 @@
+package way
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// mediaRange is a single entry of an Accept header.
+type mediaRange struct {
+	typ     string
+	subtype string
+	q       float64
+	order   int
+}
+
+// parseAccept parses an Accept header into media ranges sorted by
+// preference: higher q-values first, then more specific ranges,
+// then the order they appeared in.
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+	for i, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mt := strings.ToLower(strings.TrimSpace(params[0]))
+		if mt == "" {
+			continue
+		}
+		typ, subtype, ok := strings.Cut(mt, "/")
+		if !ok {
+			if mt != "*" {
+				continue
+			}
+			typ, subtype = "*", "*"
+		}
+		mr := mediaRange{typ: typ, subtype: subtype, q: 1, order: i}
+		for _, p := range params[1:] {
+			k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+			if strings.ToLower(strings.TrimSpace(k)) != "q" {
+				continue
+			}
+			q, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil || q < 0 || q > 1 {
+				q = 0
+			}
+			mr.q = q
+		}
+		ranges = append(ranges, mr)
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		if ranges[i].q != ranges[j].q {
+			return ranges[i].q > ranges[j].q
+		}
+		return ranges[i].specificity() > ranges[j].specificity()
+	})
+	return ranges
+}
+
+func (mr mediaRange) specificity() int {
+	switch {
+	case mr.typ == "*":
+		return 0
+	case mr.subtype == "*":
+		return 1
+	}
+	return 2
+}
+
+// matches reports whether the media range covers the media type mt.
+func (mr mediaRange) matches(mt string) bool {
+	typ, subtype, _ := strings.Cut(strings.ToLower(mt), "/")
+	if mr.typ != "*" && mr.typ != typ {
+		return false
+	}
+	return mr.subtype == "*" || mr.subtype == subtype
+}
+
+// negotiate picks the best of the offered media types for the given
+// Accept header. An empty Accept header accepts the first offer.
+// Returns an empty string if nothing offered is acceptable.
+func negotiate(accept string, offers []string) string {
+	if len(offers) == 0 {
+		return ""
+	}
+	if strings.TrimSpace(accept) == "" {
+		return offers[0]
+	}
+	ranges := parseAccept(accept)
+	best, bestQ, bestSpec := "", 0.0, -1
+	for _, offer := range offers {
+		// the most specific range covering an offer decides its q
+		match, ok := mediaRange{}, false
+		for _, mr := range ranges {
+			if mr.matches(offer) && (!ok || mr.specificity() > match.specificity()) {
+				match, ok = mr, true
+			}
+		}
+		if !ok || match.q == 0 {
+			continue
+		}
+		if match.q > bestQ || (match.q == bestQ && match.specificity() > bestSpec) {
+			best, bestQ, bestSpec = offer, match.q, match.specificity()
+		}
+	}
+	return best
+}
+
+// mediaTypeContextKey is the context key type for storing
+// the negotiated media type in context.Context.
+type mediaTypeContextKey struct{}
+
+// Produces declares the media types a route can respond with, in
+// order of preference. The best one for the Accept header of the
+// request is available to the handler via MediaType; requests
+// accepting none of them get 406 Not Acceptable.
+func Produces(types ...string) RouteOption {
+	return func(rt *route) {
+		rt.produces = append(rt.produces, types...)
+	}
+}
+
+// Consumes declares the media types a route accepts as request
+// body, such as "application/json" or "image/*". Requests with
+// a body of another Content-Type get 415 Unsupported Media Type.
+func Consumes(types ...string) RouteOption {
+	return func(rt *route) {
+		rt.consumes = append(rt.consumes, types...)
+	}
+}
+
+// MediaType gets the media type negotiated for the response from
+// the Produces option of the route matched for the request carrying
+// the specified Context. Returns an empty string if the route does
+// not declare produced media types.
+func MediaType(ctx context.Context) string {
+	mt, _ := ctx.Value(mediaTypeContextKey{}).(string)
+	return mt
+}
+
+// negotiateHandler wraps the handler of a route declaring
+// Produces or Consumes with content negotiation.
+func (rt *route) negotiateHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(rt.consumes) > 0 && hasBody(r) && !rt.accepts(r.Header.Get("Content-Type")) {
+			p := NewProblem(http.StatusUnsupportedMediaType, "Content-Type must be one of: "+strings.Join(rt.consumes, ", "))
+			p.Extensions = map[string]any{"accept": rt.consumes}
+			RenderError(w, r, p)
+			return
+		}
+		if len(rt.produces) > 0 {
+			if len(rt.produces) > 1 {
+				w.Header().Add("Vary", "Accept")
+			}
+			mt := negotiate(r.Header.Get("Accept"), rt.produces)
+			if mt == "" {
+				p := NewProblem(http.StatusNotAcceptable, "Available media types: "+strings.Join(rt.produces, ", "))
+				p.Extensions = map[string]any{"available": rt.produces}
+				RenderError(w, r, p)
+				return
+			}
+			r = r.WithContext(context.WithValue(r.Context(), mediaTypeContextKey{}, mt))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// accepts reports whether the Content-Type ct is one of the media
+// types the route consumes.
+func (rt *route) accepts(ct string) bool {
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return false
+	}
+	for _, c := range rt.consumes {
+		typ, subtype, _ := strings.Cut(strings.ToLower(c), "/")
+		if (mediaRange{typ: typ, subtype: subtype}).matches(mt) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasBody reports whether r carries a request body.
+func hasBody(r *http.Request) bool {
+	return r.ContentLength > 0 || (r.ContentLength < 0 && r.Body != nil && r.Body != http.NoBody)
+}
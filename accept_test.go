@@ -0,0 +1,179 @@
+package way
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseAccept(t *testing.T) {
+	tests := []struct {
+		name   string
+		accept string
+		want   []mediaRange
+	}{
+		{
+			name:   "q-values",
+			accept: "*/*;q=0.1, application/json;q=0.9, text/html",
+			want: []mediaRange{
+				{typ: "text", subtype: "html", q: 1, order: 2},
+				{typ: "application", subtype: "json", q: 0.9, order: 1},
+				{typ: "*", subtype: "*", q: 0.1, order: 0},
+			},
+		},
+		{
+			name:   "specificity",
+			accept: "*/*, text/*, text/html",
+			want: []mediaRange{
+				{typ: "text", subtype: "html", q: 1, order: 2},
+				{typ: "text", subtype: "*", q: 1, order: 1},
+				{typ: "*", subtype: "*", q: 1, order: 0},
+			},
+		},
+		{
+			name:   "order",
+			accept: "text/csv, application/json",
+			want: []mediaRange{
+				{typ: "text", subtype: "csv", q: 1, order: 0},
+				{typ: "application", subtype: "json", q: 1, order: 1},
+			},
+		},
+		{
+			name:   "case and parameters",
+			accept: "Text/HTML; charset=utf-8; Q=0.5",
+			want:   []mediaRange{{typ: "text", subtype: "html", q: 0.5, order: 0}},
+		},
+		{
+			name:   "invalid q-values",
+			accept: "text/html;q=2, text/csv;q=abc, text/plain;q=-1",
+			want: []mediaRange{
+				{typ: "text", subtype: "html", q: 0, order: 0},
+				{typ: "text", subtype: "csv", q: 0, order: 1},
+				{typ: "text", subtype: "plain", q: 0, order: 2},
+			},
+		},
+		{
+			name:   "bare wildcard",
+			accept: "*;q=0.2",
+			want:   []mediaRange{{typ: "*", subtype: "*", q: 0.2, order: 0}},
+		},
+		{
+			name:   "malformed entries",
+			accept: "text/html,, bogus ,application/json",
+			want: []mediaRange{
+				{typ: "text", subtype: "html", q: 1, order: 0},
+				{typ: "application", subtype: "json", q: 1, order: 3},
+			},
+		},
+		{name: "empty", accept: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseAccept(tt.accept); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseAccept(%q) = %+v, want %+v", tt.accept, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name   string
+		accept string
+		offers []string
+		want   string
+	}{
+		{name: "no Accept", offers: []string{"text/html", "application/json"}, want: "text/html"},
+		{name: "no offers", accept: "*/*"},
+		{name: "exact", accept: "application/json", offers: []string{"text/html", "application/json"}, want: "application/json"},
+		{name: "higher q-value", accept: "text/html;q=0.5, application/json", offers: []string{"text/html", "application/json"}, want: "application/json"},
+		{name: "wildcard takes first offer", accept: "*/*", offers: []string{"text/html", "application/json"}, want: "text/html"},
+		{name: "subtype wildcard", accept: "image/*", offers: []string{"text/html", "image/webp", "image/png"}, want: "image/webp"},
+		{name: "more specific offer at same q", accept: "*/*, application/json", offers: []string{"text/html", "application/json"}, want: "application/json"},
+		{name: "most specific range decides q", accept: "text/*;q=0.5, text/csv", offers: []string{"text/html", "text/csv"}, want: "text/csv"},
+		{name: "excluded by specific range", accept: "text/*, text/html;q=0", offers: []string{"text/html", "text/plain"}, want: "text/plain"},
+		{name: "wildcard excluded", accept: "*/*;q=0, text/csv", offers: []string{"application/json"}},
+		{name: "case-insensitive", accept: "APPLICATION/JSON", offers: []string{"Application/Json"}, want: "Application/Json"},
+		{name: "nothing acceptable", accept: "image/png", offers: []string{"text/html", "application/json"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := negotiate(tt.accept, tt.offers); got != tt.want {
+				t.Errorf("negotiate(%q, %q) = %q, want %q", tt.accept, tt.offers, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNegotiateHandler(t *testing.T) {
+	rtr := NewRouter()
+	rtr.ErrorHandler = WriteProblem
+	mediaType := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(MediaType(r.Context())))
+	})
+	rtr.POST("/songs", mediaType,
+		Produces("application/json", "text/csv"),
+		Consumes("application/json", "text/*"))
+	rtr.POST("/plain", mediaType)
+
+	tests := []struct {
+		name        string
+		path        string
+		accept      string
+		contentType string
+		body        string
+		status      int
+		want        string
+		// extension is the problem member listing the media types
+		extension string
+	}{
+		{name: "default", path: "/songs", status: http.StatusOK, want: "application/json"},
+		{name: "negotiated", path: "/songs", accept: "text/*", status: http.StatusOK, want: "text/csv"},
+		{name: "not acceptable", path: "/songs", accept: "image/png", status: http.StatusNotAcceptable, extension: "available"},
+		{name: "consumed", path: "/songs", contentType: "application/json", body: "{}", status: http.StatusOK, want: "application/json"},
+		{name: "consumed wildcard with parameters", path: "/songs", contentType: "Text/Plain; charset=utf-8", body: "hi", status: http.StatusOK, want: "application/json"},
+		{name: "unsupported", path: "/songs", contentType: "application/xml", body: "<song/>", status: http.StatusUnsupportedMediaType, extension: "accept"},
+		{name: "invalid Content-Type", path: "/songs", contentType: "json", body: "{}", status: http.StatusUnsupportedMediaType, extension: "accept"},
+		{name: "missing Content-Type", path: "/songs", body: "{}", status: http.StatusUnsupportedMediaType, extension: "accept"},
+		{name: "no body", path: "/songs", contentType: "application/xml", status: http.StatusOK, want: "application/json"},
+		{name: "undeclared", path: "/plain", accept: "image/png", contentType: "application/xml", body: "<song/>", status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			rtr.ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.extension == "" {
+				if got := w.Body.String(); got != tt.want {
+					t.Errorf("media type = %q, want %q", got, tt.want)
+				}
+				return
+			}
+			var p map[string]any
+			if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := p[tt.extension].([]any); !ok {
+				t.Errorf("problem = %v, want the media types in %q", p, tt.extension)
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	rtr.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/songs", nil))
+	if got := w.Header().Get("Vary"); got != "Accept" {
+		t.Errorf("Vary = %q, want Accept", got)
+	}
+}
@@ -0,0 +1,116 @@
+package way
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// Assets serves a tree of static assets, typically an embed.FS with a
+// frontend bundle, under content-hashed names. Every file is hashed
+// once by NewAssets, so that "css/site.css" is also served as, say,
+// "css/site.3f2a1b9c.css" with immutable caching headers: its content
+// can only change along with its name. Templates link to the hashed
+// names with the URL method or the "asset" template function.
+type Assets struct {
+	prefix  string
+	files   *fileHandler
+	hashed  map[string]string // logical name -> hashed name
+	logical map[string]string // hashed name -> logical name
+}
+
+// immutable is the Cache-Control header of hashed asset names.
+const immutable = "public, max-age=31536000, immutable"
+
+// NewAssets hashes the files of fsys to serve them under the path prefix.
+func NewAssets(prefix string, fsys fs.FS) (*Assets, error) {
+	a := &Assets{
+		prefix:  strings.TrimSuffix(prefix, "/"),
+		hashed:  map[string]string{},
+		logical: map[string]string{},
+	}
+	a.files = &fileHandler{fsys: fsys, base: a.prefix}
+
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		f, err := fsys.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		hash := sha256.New()
+		if _, err := io.Copy(hash, f); err != nil {
+			return err
+		}
+		sum := hash.Sum(nil)
+
+		ext := path.Ext(name)
+		hashedName := strings.TrimSuffix(name, ext) + "." + hex.EncodeToString(sum[:4]) + ext
+		a.hashed[name] = hashedName
+		a.logical[hashedName] = name
+		// spare serveFile hashing the content again for the ETag
+		key := fileKey{name: name, size: info.Size(), modTime: info.ModTime()}
+		a.files.etags.Store(key, `"`+hex.EncodeToString(sum[:16])+`"`)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// URL returns the URL path of the hashed name of the asset with the
+// logical name, e.g. "css/site.css". Names of unknown assets are
+// returned unhashed under the prefix.
+func (a *Assets) URL(name string) string {
+	name = strings.TrimPrefix(name, "/")
+	if hashed, ok := a.hashed[name]; ok {
+		name = hashed
+	}
+	return a.prefix + "/" + name
+}
+
+// FuncMap returns template functions for linking to the assets:
+//
+//	<link rel="stylesheet" href="{{ asset "css/site.css" }}">
+func (a *Assets) FuncMap() template.FuncMap {
+	return template.FuncMap{"asset": a.URL}
+}
+
+// ServeHTTP serves the asset named by the request path under the
+// prefix. Hashed names are served with immutable caching headers,
+// logical names with headers requiring revalidation.
+func (a *Assets) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(path.Clean("/"+strings.TrimPrefix(r.URL.Path, a.prefix)), "/")
+	cacheControl := "no-cache"
+	if logical, ok := a.logical[name]; ok {
+		name, cacheControl = logical, immutable
+	} else if _, ok := a.hashed[name]; !ok {
+		RenderError(w, r, NewProblem(http.StatusNotFound, ""))
+		return
+	}
+	info, err := fs.Stat(a.files.fsys, name)
+	if err != nil {
+		RenderError(w, r, NewProblem(http.StatusNotFound, ""))
+		return
+	}
+	w.Header().Set("Cache-Control", cacheControl)
+	a.files.serveFile(w, r, name, info)
+}
+
+// ServeAssets serves a under its prefix for GET and HEAD requests.
+// Route options configure the route registered for the prefix.
+func (rtr *Router) ServeAssets(a *Assets, routeOpts ...RouteOption) {
+	rtr.Handle(WAY_GET|WAY_HEAD, a.prefix+"/...", a, routeOpts...)
+}
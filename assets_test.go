@@ -0,0 +1,99 @@
+package way
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// shortHash returns the hash NewAssets puts in the names of files with content.
+func shortHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:4])
+}
+
+func TestAssets(t *testing.T) {
+	a, err := NewAssets("/assets/", fstest.MapFS{
+		"css/site.css": {Data: []byte("body{}")},
+		"app.js":       {Data: []byte("app()")},
+		"LICENSE":      {Data: []byte("MIT")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	css := "/assets/css/site." + shortHash("body{}") + ".css"
+	js := "/assets/app." + shortHash("app()") + ".js"
+
+	t.Run("URL", func(t *testing.T) {
+		tests := []struct {
+			name string
+			want string
+		}{
+			{name: "css/site.css", want: css},
+			{name: "/app.js", want: js},
+			{name: "LICENSE", want: "/assets/LICENSE." + shortHash("MIT")},
+			{name: "missing.js", want: "/assets/missing.js"},
+		}
+		for _, tt := range tests {
+			if got := a.URL(tt.name); got != tt.want {
+				t.Errorf("URL(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		}
+	})
+
+	t.Run("FuncMap", func(t *testing.T) {
+		tmpl := template.Must(template.New("").Funcs(a.FuncMap()).Parse(`<link href="{{ asset "css/site.css" }}">`))
+		var b strings.Builder
+		if err := tmpl.Execute(&b, nil); err != nil {
+			t.Fatal(err)
+		}
+		if want := `<link href="` + css + `">`; b.String() != want {
+			t.Errorf("template = %q, want %q", b.String(), want)
+		}
+	})
+
+	rtr := NewRouter()
+	rtr.ServeAssets(a)
+	tests := []struct {
+		name         string
+		path         string
+		status       int
+		cacheControl string
+		want         string
+	}{
+		{name: "hashed", path: css, status: http.StatusOK, cacheControl: "public, max-age=31536000, immutable", want: "body{}"},
+		{name: "logical", path: "/assets/css/site.css", status: http.StatusOK, cacheControl: "no-cache", want: "body{}"},
+		{name: "hashed without extension", path: "/assets/LICENSE." + shortHash("MIT"), status: http.StatusOK, cacheControl: "public, max-age=31536000, immutable", want: "MIT"},
+		{name: "stale hash", path: "/assets/css/site.00000000.css", status: http.StatusNotFound},
+		{name: "unknown", path: "/assets/missing.js", status: http.StatusNotFound},
+		{name: "directory", path: "/assets/css/", status: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			rtr.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if got := w.Header().Get("Cache-Control"); got != tt.cacheControl {
+				t.Errorf("Cache-Control = %q, want %q", got, tt.cacheControl)
+			}
+			if tt.status == http.StatusOK && w.Body.String() != tt.want {
+				t.Errorf("body = %q, want %q", w.Body, tt.want)
+			}
+		})
+	}
+
+	// the ETag is the one precomputed by NewAssets
+	w := httptest.NewRecorder()
+	rtr.ServeHTTP(w, httptest.NewRequest(http.MethodGet, js, nil))
+	sum := sha256.Sum256([]byte("app()"))
+	if want := `"` + hex.EncodeToString(sum[:16]) + `"`; w.Header().Get("ETag") != want {
+		t.Errorf("ETag = %q, want %q", w.Header().Get("ETag"), want)
+	}
+}
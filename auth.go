@@ -0,0 +1,221 @@
+package way
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// principalContextKey is the context key type for storing
+// the authenticated Principal in context.Context.
+type principalContextKey struct{}
+
+// Principal is the identity an authentication middleware
+// established for a request.
+type Principal struct {
+	// ID identifies the principal, e.g. a user name or token subject.
+	ID string
+	// Scheme is the authentication scheme used, e.g. "Basic".
+	Scheme string
+	// Scopes and Roles are the permissions of the principal.
+	Scopes []string
+	Roles  []string
+	// Claims holds the claims of a verified token, if any.
+	Claims map[string]any
+	// Value holds application data, such as a user record.
+	Value any
+}
+
+// PrincipalFrom gets the authenticated Principal from the specified
+// Context. Returns false if the request was not authenticated.
+func PrincipalFrom(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalContextKey{}).(*Principal)
+	return p, ok && p != nil
+}
+
+// WithPrincipal returns a copy of ctx carrying p, for authentication
+// middleware besides the ones of this package.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, p)
+}
+
+// ErrUnauthenticated can be returned by validation callbacks to
+// reject credentials without further explanation.
+var ErrUnauthenticated = errors.New("way: invalid credentials")
+
+// BasicAuthOptions configures the BasicAuth middleware.
+type BasicAuthOptions struct {
+	// Realm is sent in the WWW-Authenticate header.
+	Realm string
+	// Users maps user names to passwords. They are compared in
+	// constant time.
+	Users map[string]string
+	// Validate checks credentials of users not in Users. They are
+	// rejected if it returns an error or a nil Principal.
+	Validate func(ctx context.Context, user, password string) (*Principal, error)
+}
+
+// BasicAuth returns a Middleware authenticating requests with HTTP
+// Basic authentication (RFC 7617).
+func BasicAuth(opts BasicAuthOptions) Middleware {
+	challenge := `Basic realm=` + strconv.Quote(opts.Realm) + `, charset="UTF-8"`
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, password, ok := r.BasicAuth()
+			if !ok {
+				unauthorized(w, r, challenge, "Basic authentication is required.")
+				return
+			}
+			var p *Principal
+			if want, known := opts.Users[user]; known && secureCompare(password, want) {
+				p = &Principal{ID: user}
+			} else if !known && opts.Validate != nil {
+				var err error
+				if p, err = opts.Validate(r.Context(), user, password); err != nil {
+					p = nil
+				}
+			} else if !known {
+				// spend the same time as for known users
+				secureCompare(password, "")
+			}
+			if p == nil {
+				unauthorized(w, r, challenge, "Invalid user name or password.")
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), withScheme(p, "Basic"))))
+		})
+	}
+}
+
+// BearerAuthOptions configures the BearerAuth middleware.
+type BearerAuthOptions struct {
+	// Realm is sent in the WWW-Authenticate header.
+	Realm string
+	// Validate checks a bearer token, returning the principal
+	// it identifies, or an error to reject it. Required. Only the
+	// ErrToken errors are described to the client; errors wrapping
+	// ErrKeysUnavailable are answered with 503 Service Unavailable.
+	Validate func(ctx context.Context, token string) (*Principal, error)
+}
+
+// BearerAuth returns a Middleware authenticating requests with
+// bearer tokens in the Authorization header (RFC 6750).
+func BearerAuth(opts BearerAuthOptions) Middleware {
+	challenge := `Bearer realm=` + strconv.Quote(opts.Realm)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+			token = strings.TrimSpace(token)
+			if !strings.EqualFold(scheme, "Bearer") || token == "" {
+				unauthorized(w, r, challenge, "A bearer token is required.")
+				return
+			}
+			p, err := opts.Validate(r.Context(), token)
+			switch {
+			case errors.Is(err, ErrKeysUnavailable):
+				RenderError(w, r, NewProblem(http.StatusServiceUnavailable, "The token could not be verified."))
+				return
+			case errors.Is(err, errKeyType):
+				RenderError(w, r, NewProblem(http.StatusInternalServerError, ""))
+				return
+			}
+			if err != nil || p == nil {
+				desc := "The access token is invalid."
+				for _, e := range tokenErrors {
+					if errors.Is(err, e) {
+						desc = strings.TrimPrefix(e.Error(), "way: ")
+						break
+					}
+				}
+				unauthorized(w, r, challenge+`, error="invalid_token", error_description=`+strconv.Quote(desc), desc)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), withScheme(p, "Bearer"))))
+		})
+	}
+}
+
+// APIKeyOptions configures the APIKeyAuth middleware.
+type APIKeyOptions struct {
+	// Realm is sent in the WWW-Authenticate header.
+	Realm string
+	// Header is the request header carrying the key.
+	// By default "X-API-Key".
+	Header string
+	// Query is the query parameter carrying the key when the
+	// header is absent. By default keys are only read from Header.
+	Query string
+	// Keys maps keys to the ID of their principal.
+	// They are compared in constant time.
+	Keys map[string]string
+	// Validate checks keys not in Keys. They are rejected if it
+	// returns an error or a nil Principal.
+	Validate func(ctx context.Context, key string) (*Principal, error)
+}
+
+// APIKeyAuth returns a Middleware authenticating requests
+// with an API key in a header or query parameter.
+func APIKeyAuth(opts APIKeyOptions) Middleware {
+	if opts.Header == "" {
+		opts.Header = "X-API-Key"
+	}
+	challenge := `APIKey realm=` + strconv.Quote(opts.Realm) + `, header=` + strconv.Quote(opts.Header)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(opts.Header)
+			if key == "" && opts.Query != "" {
+				key = r.URL.Query().Get(opts.Query)
+			}
+			if key == "" {
+				unauthorized(w, r, challenge, "An API key is required.")
+				return
+			}
+			var p *Principal
+			for k, id := range opts.Keys {
+				// keep comparing after a match to not leak which key matched
+				if secureCompare(key, k) && p == nil {
+					p = &Principal{ID: id}
+				}
+			}
+			if p == nil && opts.Validate != nil {
+				var err error
+				if p, err = opts.Validate(r.Context(), key); err != nil {
+					p = nil
+				}
+			}
+			if p == nil {
+				unauthorized(w, r, challenge, "Invalid API key.")
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), withScheme(p, "APIKey"))))
+		})
+	}
+}
+
+// withScheme returns a copy of p with its Scheme set, leaving
+// principals returned by validation callbacks untouched.
+func withScheme(p *Principal, scheme string) *Principal {
+	cp := *p
+	cp.Scheme = scheme
+	return &cp
+}
+
+// unauthorized responds 401 with the authentication challenge, if any.
+func unauthorized(w http.ResponseWriter, r *http.Request, challenge, detail string) {
+	if challenge != "" {
+		w.Header().Set("WWW-Authenticate", challenge)
+	}
+	RenderError(w, r, NewProblem(http.StatusUnauthorized, detail))
+}
+
+// secureCompare compares two secrets in constant time. Hashing
+// first keeps the time independent of their lengths too.
+func secureCompare(given, want string) bool {
+	g := sha256.Sum256([]byte(given))
+	x := sha256.Sum256([]byte(want))
+	return subtle.ConstantTimeCompare(g[:], x[:]) == 1
+}
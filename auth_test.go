@@ -0,0 +1,209 @@
+package way
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// serveAuth serves r through a route protected by mw, returning the
+// response and the principal the handler got.
+func serveAuth(mw Middleware, r *http.Request) (*httptest.ResponseRecorder, *Principal) {
+	var p *Principal
+	rtr := NewRouter()
+	rtr.GET("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, _ = PrincipalFrom(r.Context())
+	}), With(mw))
+	w := httptest.NewRecorder()
+	rtr.ServeHTTP(w, r)
+	return w, p
+}
+
+func TestBasicAuth(t *testing.T) {
+	shared := &Principal{ID: "carol", Roles: []string{"admin"}}
+	mw := BasicAuth(BasicAuthOptions{
+		Realm: "music",
+		Users: map[string]string{"alice": "secret"},
+		Validate: func(ctx context.Context, user, password string) (*Principal, error) {
+			switch {
+			case user == "carol" && password == "pw":
+				return shared, nil
+			case user == "carol":
+				// a principal with an error must still be rejected
+				return shared, ErrUnauthenticated
+			}
+			return nil, nil
+		},
+	})
+
+	tests := []struct {
+		name     string
+		user     string
+		password string
+		noAuth   bool
+		status   int
+		id       string
+	}{
+		{name: "user", user: "alice", password: "secret", status: http.StatusOK, id: "alice"},
+		{name: "wrong password", user: "alice", password: "nope", status: http.StatusUnauthorized},
+		{name: "wrong password of validated user", user: "alice", password: "pw", status: http.StatusUnauthorized},
+		{name: "validated", user: "carol", password: "pw", status: http.StatusOK, id: "carol"},
+		{name: "validation error", user: "carol", password: "nope", status: http.StatusUnauthorized},
+		{name: "unknown user", user: "dave", password: "secret", status: http.StatusUnauthorized},
+		{name: "no credentials", noAuth: true, status: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if !tt.noAuth {
+				r.SetBasicAuth(tt.user, tt.password)
+			}
+			w, p := serveAuth(mw, r)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.status == http.StatusUnauthorized {
+				if got := w.Header().Get("WWW-Authenticate"); got != `Basic realm="music", charset="UTF-8"` {
+					t.Errorf("WWW-Authenticate = %q", got)
+				}
+				return
+			}
+			if p.ID != tt.id || p.Scheme != "Basic" {
+				t.Errorf("principal = %+v, want %s with Basic", p, tt.id)
+			}
+		})
+	}
+	if shared.Scheme != "" {
+		t.Errorf("validated principal was modified: %+v", shared)
+	}
+}
+
+func TestBearerAuth(t *testing.T) {
+	shared := &Principal{ID: "svc"}
+	mw := BearerAuth(BearerAuthOptions{
+		Realm: "api",
+		Validate: func(ctx context.Context, token string) (*Principal, error) {
+			switch token {
+			case "good":
+				return shared, nil
+			case "revoked":
+				return shared, errors.New("way: token revoked")
+			case "wrapped":
+				return nil, errors.Join(ErrUnauthenticated, errors.New("internal detail"))
+			case "expired":
+				return nil, fmt.Errorf("checking token: %w", ErrTokenExpired)
+			case "outage":
+				return nil, fmt.Errorf("%w: internal detail", ErrKeysUnavailable)
+			}
+			return nil, nil
+		},
+	})
+
+	tests := []struct {
+		name          string
+		authorization string
+		status        int
+		challenge     string
+	}{
+		{name: "valid", authorization: "Bearer good", status: http.StatusOK},
+		{name: "scheme case", authorization: "bearer good", status: http.StatusOK},
+		{name: "no header", status: http.StatusUnauthorized, challenge: `Bearer realm="api"`},
+		{name: "other scheme", authorization: "Basic Z29vZA==", status: http.StatusUnauthorized, challenge: `Bearer realm="api"`},
+		{name: "empty token", authorization: "Bearer ", status: http.StatusUnauthorized, challenge: `Bearer realm="api"`},
+		{name: "principal with error", authorization: "Bearer revoked", status: http.StatusUnauthorized,
+			challenge: `Bearer realm="api", error="invalid_token", error_description="The access token is invalid."`},
+		{name: "unauthenticated", authorization: "Bearer wrapped", status: http.StatusUnauthorized,
+			challenge: `Bearer realm="api", error="invalid_token", error_description="The access token is invalid."`},
+		{name: "unknown", authorization: "Bearer bad", status: http.StatusUnauthorized,
+			challenge: `Bearer realm="api", error="invalid_token", error_description="The access token is invalid."`},
+		{name: "token error", authorization: "Bearer expired", status: http.StatusUnauthorized,
+			challenge: `Bearer realm="api", error="invalid_token", error_description="token is expired"`},
+		{name: "keys unavailable", authorization: "Bearer outage", status: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			w, p := serveAuth(mw, r)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if got := w.Header().Get("WWW-Authenticate"); got != tt.challenge {
+				t.Errorf("WWW-Authenticate = %s, want %s", got, tt.challenge)
+			}
+			if tt.status == http.StatusOK && (p.ID != "svc" || p.Scheme != "Bearer") {
+				t.Errorf("principal = %+v", p)
+			}
+		})
+	}
+	if shared.Scheme != "" {
+		t.Errorf("validated principal was modified: %+v", shared)
+	}
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	opts := APIKeyOptions{
+		Keys: map[string]string{"k1": "app1", "k2": "app2"},
+		Validate: func(ctx context.Context, key string) (*Principal, error) {
+			if strings.HasPrefix(key, "dyn-") {
+				return &Principal{ID: key}, nil
+			}
+			if key == "broken" {
+				return &Principal{ID: "broken"}, errors.New("lookup failed")
+			}
+			return nil, ErrUnauthenticated
+		},
+	}
+	withQuery := opts
+	withQuery.Header, withQuery.Query = "X-Key", "api_key"
+
+	tests := []struct {
+		name   string
+		opts   APIKeyOptions
+		header string
+		key    string
+		target string
+		status int
+		id     string
+	}{
+		{name: "key", opts: opts, header: "X-API-Key", key: "k2", status: http.StatusOK, id: "app2"},
+		{name: "validated", opts: opts, header: "X-API-Key", key: "dyn-7", status: http.StatusOK, id: "dyn-7"},
+		{name: "validation error", opts: opts, header: "X-API-Key", key: "broken", status: http.StatusUnauthorized},
+		{name: "unknown", opts: opts, header: "X-API-Key", key: "k3", status: http.StatusUnauthorized},
+		{name: "missing", opts: opts, status: http.StatusUnauthorized},
+		{name: "query not enabled", opts: opts, target: "/?api_key=k1", status: http.StatusUnauthorized},
+		{name: "custom header", opts: withQuery, header: "X-Key", key: "k1", status: http.StatusOK, id: "app1"},
+		{name: "query", opts: withQuery, target: "/?api_key=k1", status: http.StatusOK, id: "app1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := tt.target
+			if target == "" {
+				target = "/"
+			}
+			r := httptest.NewRequest(http.MethodGet, target, nil)
+			if tt.header != "" {
+				r.Header.Set(tt.header, tt.key)
+			}
+			w, p := serveAuth(APIKeyAuth(tt.opts), r)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.status == http.StatusUnauthorized {
+				if !strings.HasPrefix(w.Header().Get("WWW-Authenticate"), "APIKey ") {
+					t.Errorf("WWW-Authenticate = %q", w.Header().Get("WWW-Authenticate"))
+				}
+				return
+			}
+			if p.ID != tt.id || p.Scheme != "APIKey" {
+				t.Errorf("principal = %+v, want %s with APIKey", p, tt.id)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package way
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// RequireScopes makes a route require a Principal with all of the
+// scopes, responding 403 Forbidden otherwise. The Principal must be
+// put in the context by auth middleware running before the route's
+// handler, such as JWT added with Use or With.
+func RequireScopes(scopes ...string) RouteOption {
+	return func(rt *route) {
+		rt.scopes = append(rt.scopes, scopes...)
+	}
+}
+
+// RequireRoles makes a route require a Principal with at least one
+// of the roles, responding 403 Forbidden otherwise. See RequireScopes.
+func RequireRoles(roles ...string) RouteOption {
+	return func(rt *route) {
+		rt.roles = append(rt.roles, roles...)
+	}
+}
+
+// Challenge sets the WWW-Authenticate challenge of the 401 responses
+// routes requiring scopes or roles send to requests without a
+// Principal, e.g. `Basic realm="music"` when the Principal comes
+// from credentials sent with Basic authentication. Without it, such
+// responses carry no challenge. Set it on a Group for every route
+// behind the same auth middleware.
+func Challenge(challenge string) RouteOption {
+	return func(rt *route) {
+		rt.challenge = challenge
+	}
+}
+
+// authorizeHandler wraps the handler of a route checking the
+// Principal has the scopes and roles it requires.
+func (rt *route) authorizeHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := PrincipalFrom(r.Context())
+		if !ok {
+			// auth middleware would have sent its own challenge
+			unauthorized(w, r, rt.challenge, "Authentication is required.")
+			return
+		}
+		var missing []string
+		for _, s := range rt.scopes {
+			if !slices.Contains(p.Scopes, s) {
+				missing = append(missing, s)
+			}
+		}
+		if len(missing) > 0 {
+			prob := NewProblem(http.StatusForbidden, "Missing required scopes: "+strings.Join(missing, ", ")+".")
+			prob.Extensions = map[string]any{"missing_scopes": missing}
+			RenderError(w, r, prob)
+			return
+		}
+		if len(rt.roles) > 0 && !slices.ContainsFunc(rt.roles, func(role string) bool {
+			return slices.Contains(p.Roles, role)
+		}) {
+			prob := NewProblem(http.StatusForbidden, "One of these roles is required: "+strings.Join(rt.roles, ", ")+".")
+			prob.Extensions = map[string]any{"required_roles": rt.roles}
+			RenderError(w, r, prob)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RoutePermission describes what protects a route.
+type RoutePermission struct {
+	Methods []string
+	Pattern string
+	Name    string
+	// Scopes all required, and roles one of which is required.
+	// Both are empty for routes open to anyone.
+	Scopes []string
+	Roles  []string
+}
+
+// permissionMethods are the names of the method bits, WAY_GET first.
+var permissionMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+	http.MethodDelete, http.MethodOptions, http.MethodConnect, http.MethodTrace,
+}
+
+// Permissions lists the scopes and roles required by every route,
+// in the order routes were registered, e.g. to audit access rules.
+func (rtr *Router) Permissions() []RoutePermission {
+	perms := make([]RoutePermission, 0, len(rtr.routes))
+	for _, rt := range rtr.routes {
+		perm := RoutePermission{
+			Pattern: rt.pattern,
+			Name:    rt.name,
+			Scopes:  slices.Clone(rt.scopes),
+			Roles:   slices.Clone(rt.roles),
+		}
+		for i, m := range permissionMethods {
+			if rt.hasMethods(1 << i) {
+				perm.Methods = append(perm.Methods, m)
+			}
+		}
+		perms = append(perms, perm)
+	}
+	return perms
+}
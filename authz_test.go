@@ -0,0 +1,95 @@
+package way
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestAuthorize(t *testing.T) {
+	// asPrincipal authenticates requests as the principal in their
+	// X-Test-User header, if any
+	asPrincipal := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Header.Get("X-Test-User") {
+			case "reader":
+				r = r.WithContext(WithPrincipal(r.Context(), &Principal{ID: "reader", Scopes: []string{"music:read"}}))
+			case "writer":
+				r = r.WithContext(WithPrincipal(r.Context(), &Principal{ID: "writer", Scopes: []string{"music:read", "music:write"}, Roles: []string{"editor"}}))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	rtr := NewRouter()
+	rtr.Use(asPrincipal)
+	rtr.GET("/music", ok, RequireScopes("music:read"))
+	rtr.POST("/music", ok, RequireScopes("music:read", "music:write"))
+	rtr.DELETE("/music/:id", ok, RequireRoles("admin", "editor"))
+	rtr.GET("/open", ok)
+	basic := rtr.Group("/basic", Challenge(`Basic realm="music"`))
+	basic.GET("/music", ok, RequireScopes("music:read"))
+	basic.Group("/keys").GET("/music", ok, RequireScopes("music:read"), Challenge(`ApiKey realm="music"`))
+
+	tests := []struct {
+		name      string
+		method    string
+		path      string
+		user      string
+		status    int
+		challenge string
+	}{
+		{name: "open", method: http.MethodGet, path: "/open", status: http.StatusOK},
+		{name: "anonymous", method: http.MethodGet, path: "/music", status: http.StatusUnauthorized},
+		{name: "anonymous with group challenge", method: http.MethodGet, path: "/basic/music", status: http.StatusUnauthorized, challenge: `Basic realm="music"`},
+		{name: "anonymous with route challenge", method: http.MethodGet, path: "/basic/keys/music", status: http.StatusUnauthorized, challenge: `ApiKey realm="music"`},
+		{name: "authenticated with challenge", method: http.MethodGet, path: "/basic/music", user: "reader", status: http.StatusOK},
+		{name: "scope", method: http.MethodGet, path: "/music", user: "reader", status: http.StatusOK},
+		{name: "missing scope", method: http.MethodPost, path: "/music", user: "reader", status: http.StatusForbidden},
+		{name: "all scopes", method: http.MethodPost, path: "/music", user: "writer", status: http.StatusOK},
+		{name: "missing role", method: http.MethodDelete, path: "/music/1", user: "reader", status: http.StatusForbidden},
+		{name: "one of the roles", method: http.MethodDelete, path: "/music/1", user: "writer", status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.user != "" {
+				r.Header.Set("X-Test-User", tt.user)
+			}
+			rtr.ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if got := w.Header().Get("WWW-Authenticate"); got != tt.challenge {
+				t.Errorf("WWW-Authenticate = %q, want %q", got, tt.challenge)
+			}
+		})
+	}
+}
+
+func TestPermissions(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	rtr := NewRouter()
+	rtr.ALL("/tunnel", ok, RequireRoles("admin"))
+	rtr.Handle(WAY_GET|WAY_PUT, "/music/:id", ok, RequireScopes("music:write"), Name("song"))
+	rtr.Handle(WAY_CONNECT, "/connect", ok)
+
+	want := []RoutePermission{
+		{Methods: []string{"GET", "HEAD", "POST", "PUT", "DELETE", "OPTIONS", "CONNECT", "TRACE"}, Pattern: "/tunnel", Roles: []string{"admin"}},
+		{Methods: []string{"GET", "PUT"}, Pattern: "/music/:id", Name: "song", Scopes: []string{"music:write"}},
+		{Methods: []string{"CONNECT"}, Pattern: "/connect"},
+	}
+	got := rtr.Permissions()
+	if len(got) != len(want) {
+		t.Fatalf("got %d permissions, want %d", len(got), len(want))
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if !slices.Equal(g.Methods, w.Methods) || g.Pattern != w.Pattern || g.Name != w.Name ||
+			!slices.Equal(g.Scopes, w.Scopes) || !slices.Equal(g.Roles, w.Roles) {
+			t.Errorf("permission %d = %+v, want %+v", i, g, w)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package way
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BindError is returned by Bind, listing every value
+// that could not be converted to the type of its field.
+type BindError []ValidationError
+
+// Error implements the error interface.
+func (e BindError) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Bind fills the struct pointed to by dst from r. Fields are bound
+// according to their tags:
+//
+//	ID     int      `path:"id"`          // path parameter, see Param
+//	Limit  int      `query:"limit"`      // query string value
+//	Tags   []string `query:"tag"`        // every value of a repeated key
+//	Tenant string   `header:"X-Tenant"`  // request header
+//	Page   int      `query:"page" default:"1"`
+//
+// Values are converted to the field type, which can be a string,
+// bool, integer, float, time.Duration, an encoding.TextUnmarshaler,
+// a pointer to one of these or a slice, which takes every value.
+// The default tag is used when the value is absent. Fields of
+// embedded structs are bound too. Conversion failures do not stop
+// binding; they are all returned in a BindError.
+func Bind(r *http.Request, dst any) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return errors.New("way: bind destination must be a pointer to a struct")
+	}
+	var errs BindError
+	bindStruct(r, r.URL.Query(), v.Elem(), &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func bindStruct(r *http.Request, query url.Values, v reflect.Value, errs *BindError) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			bindStruct(r, query, v.Field(i), errs)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		var in, name string
+		var values []string
+		if name = field.Tag.Get("path"); name != "" {
+			in = "path"
+			if p := Param(r.Context(), name); p != "" {
+				values = []string{p}
+			}
+		} else if name = field.Tag.Get("query"); name != "" {
+			in = "query"
+			values = query[name]
+		} else if name = field.Tag.Get("header"); name != "" {
+			in = "header"
+			values = r.Header.Values(name)
+		} else {
+			continue
+		}
+		if len(values) == 0 {
+			def, ok := field.Tag.Lookup("default")
+			if !ok {
+				continue
+			}
+			values = []string{def}
+		}
+		if err := setField(v.Field(i), values); err != nil {
+			*errs = append(*errs, ValidationError{In: in, Name: name, Message: err.Error()})
+		}
+	}
+}
+
+// setField converts values to the type of the field and sets it.
+// Slice fields take every value, other fields the first one.
+func setField(f reflect.Value, values []string) error {
+	if f.Kind() == reflect.Slice && f.Type().Elem().Kind() != reflect.Uint8 {
+		s := reflect.MakeSlice(f.Type(), len(values), len(values))
+		for i, v := range values {
+			if err := setValue(s.Index(i), v); err != nil {
+				return err
+			}
+		}
+		f.Set(s)
+		return nil
+	}
+	return setValue(f, values[0])
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func setValue(f reflect.Value, s string) error {
+	if f.CanAddr() {
+		if u, ok := f.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			return u.UnmarshalText([]byte(s))
+		}
+	}
+	if f.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", s)
+		}
+		f.SetInt(int64(d))
+		return nil
+	}
+	switch f.Kind() {
+	case reflect.Pointer:
+		v := reflect.New(f.Type().Elem())
+		if err := setValue(v.Elem(), s); err != nil {
+			return err
+		}
+		f.Set(v)
+	case reflect.String:
+		f.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", s)
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, f.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", s)
+		}
+		f.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, f.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid unsigned integer %q", s)
+		}
+		f.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, f.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid number %q", s)
+		}
+		f.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported field type %s", f.Type())
+	}
+	return nil
+}
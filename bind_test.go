@@ -0,0 +1,164 @@
+package way
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// level is a TextUnmarshaler accepting "low" and "high".
+type level int
+
+func (l *level) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "low":
+		*l = 1
+	case "high":
+		*l = 2
+	default:
+		return errors.New("unknown level " + string(text))
+	}
+	return nil
+}
+
+type paging struct {
+	Page  int `query:"page" default:"1"`
+	Limit int `query:"limit" default:"20"`
+}
+
+type songQuery struct {
+	paging
+	Band     string        `path:"band"`
+	Tags     []string      `query:"tag"`
+	Years    []uint16      `query:"year"`
+	Live     *bool         `query:"live"`
+	Rating   *float64      `query:"rating"`
+	Level    level         `query:"level"`
+	MinLevel *level        `query:"min_level"`
+	Timeout  time.Duration `query:"timeout" default:"5s"`
+	Tenant   string        `header:"X-Tenant"`
+	Accepts  []string      `header:"Accept"`
+	Sort     string        `query:"sort" default:"title"`
+	Untagged string
+	secret   string `query:"secret"`
+}
+
+func TestBind(t *testing.T) {
+	var got songQuery
+	var gotErr error
+	rtr := NewRouter()
+	rtr.GET("/bands/:band/songs", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = songQuery{}
+		gotErr = Bind(r, &got)
+	}))
+
+	yes, rating, high := true, 4.5, level(2)
+	tests := []struct {
+		name    string
+		query   string
+		headers http.Header
+		want    songQuery
+		err     BindError
+	}{
+		{
+			name: "defaults",
+			want: songQuery{paging: paging{Page: 1, Limit: 20}, Band: "queen", Timeout: 5 * time.Second, Sort: "title"},
+		},
+		{
+			name:    "every value",
+			query:   "page=3&limit=50&tag=rock&tag=70s&year=1975&year=1977&live=true&rating=4.5&level=low&min_level=high&timeout=1m30s&sort=year&Untagged=x&secret=x",
+			headers: http.Header{"X-Tenant": {"acme"}, "Accept": {"text/html", "application/json"}},
+			want: songQuery{
+				paging:   paging{Page: 3, Limit: 50},
+				Band:     "queen",
+				Tags:     []string{"rock", "70s"},
+				Years:    []uint16{1975, 1977},
+				Live:     &yes,
+				Rating:   &rating,
+				Level:    1,
+				MinLevel: &high,
+				Timeout:  90 * time.Second,
+				Tenant:   "acme",
+				Accepts:  []string{"text/html", "application/json"},
+				Sort:     "year",
+			},
+		},
+		{
+			name:  "empty value is not absent",
+			query: "sort=",
+			want:  songQuery{paging: paging{Page: 1, Limit: 20}, Band: "queen", Timeout: 5 * time.Second},
+		},
+		{
+			// fields failing to convert are left unset, slices included
+			name:  "every failure",
+			query: "page=first&year=1975&year=-1&live=maybe&rating=high&level=medium&min_level=none&timeout=soon",
+			want:  songQuery{paging: paging{Limit: 20}, Band: "queen", Sort: "title"},
+			err: BindError{
+				{In: "query", Name: "page", Message: `invalid integer "first"`},
+				{In: "query", Name: "year", Message: `invalid unsigned integer "-1"`},
+				{In: "query", Name: "live", Message: `invalid boolean "maybe"`},
+				{In: "query", Name: "rating", Message: `invalid number "high"`},
+				{In: "query", Name: "level", Message: "unknown level medium"},
+				{In: "query", Name: "min_level", Message: "unknown level none"},
+				{In: "query", Name: "timeout", Message: `invalid duration "soon"`},
+			},
+		},
+		{
+			name:  "out of range",
+			query: "year=65536",
+			want:  songQuery{paging: paging{Page: 1, Limit: 20}, Band: "queen", Timeout: 5 * time.Second, Sort: "title"},
+			err:   BindError{{In: "query", Name: "year", Message: `invalid unsigned integer "65536"`}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/bands/queen/songs?"+tt.query, nil)
+			for k, v := range tt.headers {
+				r.Header[k] = v
+			}
+			rtr.ServeHTTP(httptest.NewRecorder(), r)
+			if tt.err == nil {
+				if gotErr != nil {
+					t.Fatalf("Bind() = %v", gotErr)
+				}
+			} else {
+				var be BindError
+				if !errors.As(gotErr, &be) || !reflect.DeepEqual(be, tt.err) {
+					t.Fatalf("Bind() = %#v, want %#v", gotErr, tt.err)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Bind() bound %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBindErrors(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/?ch=x", nil)
+	for _, dst := range []any{nil, songQuery{}, new(int)} {
+		if err := Bind(r, dst); err == nil || !strings.HasPrefix(err.Error(), "way: ") {
+			t.Errorf("Bind(%T) = %v, want an error", dst, err)
+		}
+	}
+
+	var unsupported struct {
+		Ch chan int `query:"ch"`
+	}
+	err := Bind(r, &unsupported)
+	if want := "query ch: unsupported field type chan int"; err == nil || err.Error() != want {
+		t.Errorf("Bind() = %v, want %q", err, want)
+	}
+
+	err = BindError{
+		{In: "query", Name: "page", Message: "invalid"},
+		{In: "header", Name: "X-Tenant", Message: "missing"},
+	}
+	if want := "query page: invalid; header X-Tenant: missing"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err, want)
+	}
+}
@@ -0,0 +1,334 @@
+package way
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Encoder makes a writer compressing to w with a content coding.
+// The writer may implement Flush() error to support flushing.
+type Encoder func(w io.Writer) io.WriteCloser
+
+// CompressOptions configures the Compress middleware.
+type CompressOptions struct {
+	// Level is the gzip and deflate compression level.
+	// By default uses gzip.DefaultCompression.
+	Level int
+	// MinSize is the size in bytes below which responses are not
+	// compressed. By default 1024.
+	MinSize int
+	// Encoders adds content codings besides gzip and deflate, such
+	// as "br" or "zstd" backed by third party packages, or replaces
+	// the built-in ones.
+	Encoders map[string]Encoder
+	// Preference lists the codings in order of preference when the
+	// client accepts several equally. By default "zstd", "br",
+	// "gzip" and "deflate".
+	Preference []string
+}
+
+// Compress returns a Middleware compressing responses with the
+// content coding negotiated from the Accept-Encoding header.
+// Responses that are small, already encoded, partial, or of content
+// types that are already compressed such as images, are sent as is.
+// HEAD requests get the headers GET requests would, if their handler
+// writes the body or declares its Content-Length as for GET.
+// Flush and Hijack are passed through to the underlying writer.
+func Compress(opts CompressOptions) Middleware {
+	if opts.MinSize == 0 {
+		opts.MinSize = 1024
+	}
+	if opts.Level == 0 || opts.Level < gzip.HuffmanOnly || opts.Level > gzip.BestCompression {
+		opts.Level = gzip.DefaultCompression
+	}
+	if len(opts.Preference) == 0 {
+		opts.Preference = []string{"zstd", "br", "gzip", "deflate"}
+	}
+	encoders := map[string]Encoder{
+		"gzip": pooledEncoder(func(w io.Writer) resetWriteCloser {
+			zw, _ := gzip.NewWriterLevel(w, opts.Level) // the level is valid
+			return zw
+		}),
+		"deflate": pooledEncoder(func(w io.Writer) resetWriteCloser {
+			zw, _ := flate.NewWriter(w, opts.Level)
+			return zw
+		}),
+	}
+	for name, enc := range opts.Encoders {
+		encoders[strings.ToLower(name)] = enc
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			coding := negotiateEncoding(r.Header.Get("Accept-Encoding"), opts.Preference, encoders)
+			if coding == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{
+				ResponseWriter: w,
+				coding:         coding,
+				encoder:        encoders[coding],
+				minSize:        opts.MinSize,
+				head:           r.Method == http.MethodHead,
+			}
+			defer cw.close()
+			if _, ok := w.(http.Hijacker); ok {
+				next.ServeHTTP(struct {
+					*compressWriter
+					http.Hijacker
+				}{cw, hijackFunc(cw.hijack)}, r)
+				return
+			}
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// negotiateEncoding picks the content coding to use for the
+// Accept-Encoding header, preferring higher q-values, then the
+// server preference. Returns an empty string for identity.
+func negotiateEncoding(accept string, preference []string, encoders map[string]Encoder) string {
+	best, bestQ := "", 0.0
+	for _, coding := range preference {
+		if encoders[coding] == nil {
+			continue
+		}
+		q := encodingQ(accept, coding)
+		if q > bestQ {
+			best, bestQ = coding, q
+		}
+	}
+	return best
+}
+
+// encodingQ returns the q-value the Accept-Encoding
+// header gives to the coding, 0 if not acceptable.
+func encodingQ(accept, coding string) float64 {
+	q, wildcard := -1.0, -1.0
+	for _, part := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		v := 1.0
+		if k, qv, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(k) == "q" {
+			if f, err := strconv.ParseFloat(strings.TrimSpace(qv), 64); err == nil {
+				v = f
+			}
+		}
+		switch name {
+		case coding:
+			q = v
+		case "*":
+			wildcard = v
+		}
+	}
+	if q >= 0 {
+		return q
+	}
+	return max(wildcard, 0)
+}
+
+// pooledEncoder makes an Encoder reusing the writers made by newWriter.
+func pooledEncoder(newWriter func(io.Writer) resetWriteCloser) Encoder {
+	pool := &sync.Pool{}
+	return func(w io.Writer) io.WriteCloser {
+		if zw, ok := pool.Get().(resetWriteCloser); ok {
+			zw.Reset(w)
+			return &pooledWriter{resetWriteCloser: zw, pool: pool}
+		}
+		return &pooledWriter{resetWriteCloser: newWriter(w), pool: pool}
+	}
+}
+
+type resetWriteCloser interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+	Flush() error
+}
+
+type pooledWriter struct {
+	resetWriteCloser
+	pool *sync.Pool
+}
+
+func (pw *pooledWriter) Close() error {
+	err := pw.resetWriteCloser.Close()
+	pw.pool.Put(pw.resetWriteCloser)
+	return err
+}
+
+// compressWriter buffers the start of a response until it can decide
+// whether to compress it, then writes through an encoder or as is.
+type compressWriter struct {
+	http.ResponseWriter
+	coding  string
+	encoder Encoder
+	minSize int
+	head    bool // the response has no body
+
+	status  int
+	buf     []byte
+	decided bool
+	enc     io.WriteCloser // nil when writing uncompressed
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.decided || code < http.StatusOK {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if cw.status == 0 {
+		cw.status = code
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.decided {
+		cw.buf = append(cw.buf, b...)
+		if len(cw.buf) < cw.minSize {
+			return len(b), nil
+		}
+		if err := cw.decide(); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if cw.enc != nil {
+		return cw.enc.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// decide chooses whether to compress, writes the header
+// and the buffered start of the body.
+func (cw *compressWriter) decide() error {
+	cw.decided = true
+	h := cw.Header()
+	if h.Get("Content-Type") == "" && len(cw.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+	size := len(cw.buf)
+	if cl, err := strconv.Atoi(h.Get("Content-Length")); err == nil && cw.head {
+		size = max(size, cl)
+	}
+	if cw.compressible(size) {
+		h.Del("Content-Length")
+		h.Del("Accept-Ranges")
+		h.Set("Content-Encoding", cw.coding)
+		if cw.head {
+			cw.enc = discardCloser{}
+		} else {
+			cw.enc = cw.encoder(cw.ResponseWriter)
+		}
+	}
+	if cw.status != 0 {
+		cw.ResponseWriter.WriteHeader(cw.status)
+	}
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if cw.enc != nil {
+		_, err = cw.enc.Write(buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+func (cw *compressWriter) compressible(size int) bool {
+	switch cw.status {
+	case 0, http.StatusOK, http.StatusCreated, http.StatusAccepted, http.StatusNonAuthoritativeInfo:
+	default:
+		return false
+	}
+	h := cw.Header()
+	if h.Get("Content-Encoding") != "" || size < cw.minSize {
+		return false
+	}
+	if cl, err := strconv.Atoi(h.Get("Content-Length")); err == nil && cl < cw.minSize {
+		return false
+	}
+	return !precompressedType(h.Get("Content-Type"))
+}
+
+// discardCloser drops the body of a compressed HEAD response.
+type discardCloser struct{}
+
+func (discardCloser) Write(b []byte) (int, error) { return len(b), nil }
+
+func (discardCloser) Close() error { return nil }
+
+// precompressedType reports whether content of the media type
+// is usually compressed already.
+func precompressedType(ct string) bool {
+	mt, _, _ := strings.Cut(strings.ToLower(ct), ";")
+	mt = strings.TrimSpace(mt)
+	switch {
+	case mt == "image/svg+xml":
+		return false
+	case strings.HasPrefix(mt, "image/"), strings.HasPrefix(mt, "video/"), strings.HasPrefix(mt, "audio/"),
+		strings.HasPrefix(mt, "font/woff"):
+		return true
+	}
+	switch mt {
+	case "application/zip", "application/gzip", "application/x-gzip", "application/x-bzip2",
+		"application/x-xz", "application/zstd", "application/x-7z-compressed", "application/x-rar-compressed",
+		"application/pdf":
+		return true
+	}
+	return false
+}
+
+// Flush sends the buffered response, compressing
+// it if possible, and flushes the underlying writer.
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		// streaming responses are compressed regardless of size
+		cw.minSize = 0
+		cw.decide()
+	}
+	if f, ok := cw.enc.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (cw *compressWriter) hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := cw.ResponseWriter.(http.Hijacker).Hijack()
+	if err == nil {
+		// the connection is the handler's now, close must not write
+		cw.decided = true
+		cw.buf = nil
+	}
+	return conn, brw, err
+}
+
+// Unwrap returns the wrapped http.ResponseWriter
+// for use by http.ResponseController.
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// close completes the response once the handler returned.
+func (cw *compressWriter) close() {
+	if !cw.decided {
+		cw.decide()
+	}
+	if cw.enc != nil {
+		cw.enc.Close()
+	}
+}
@@ -0,0 +1,264 @@
+package way
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// upperEncoder is an Encoder upper-casing the response.
+func upperEncoder(w io.Writer) io.WriteCloser {
+	return upperWriter{w}
+}
+
+type upperWriter struct{ w io.Writer }
+
+func (u upperWriter) Write(b []byte) (int, error) { return u.w.Write(bytes.ToUpper(b)) }
+
+func (u upperWriter) Close() error { return nil }
+
+// decodeBody decodes a response body sent with the content coding.
+func decodeBody(t *testing.T, coding string, body []byte) string {
+	t.Helper()
+	var r io.Reader
+	switch coding {
+	case "":
+		return string(body)
+	case "gzip":
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = zr
+	case "deflate":
+		r = flate.NewReader(bytes.NewReader(body))
+	case "br":
+		return strings.ToLower(string(body))
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+// hijackRecorder is a ResponseRecorder that can be hijacked.
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (h *hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h.hijacked = true
+	c, peer := net.Pipe()
+	peer.Close()
+	return c, bufio.NewReadWriter(bufio.NewReader(c), bufio.NewWriter(c)), nil
+}
+
+func TestCompress(t *testing.T) {
+	large := strings.Repeat("way ", 512)
+	tests := []struct {
+		name   string
+		opts   CompressOptions
+		accept string
+		// header is set by the handler before writing body
+		header map[string]string
+		status int
+		body   string
+		// coding is the Content-Encoding of the response
+		coding string
+	}{
+		{name: "gzip", accept: "gzip", body: large, coding: "gzip"},
+		{name: "deflate", accept: "deflate", body: large, coding: "deflate"},
+		{name: "q-values", accept: "gzip;q=0.5, deflate", body: large, coding: "deflate"},
+		{name: "preference", accept: "deflate, gzip", body: large, coding: "gzip"},
+		{name: "wildcard", accept: "*", body: large, coding: "gzip"},
+		{name: "refused", accept: "gzip;q=0, *;q=0", body: large},
+		{name: "unknown coding", accept: "compress", body: large},
+		{name: "no Accept-Encoding", body: large},
+		{name: "below min size", accept: "gzip", body: "small"},
+		{name: "custom min size", opts: CompressOptions{MinSize: 4}, accept: "gzip", body: "small", coding: "gzip"},
+		{name: "declared small", accept: "gzip", header: map[string]string{"Content-Length": "10"}, body: large},
+		{name: "image", accept: "gzip", header: map[string]string{"Content-Type": "image/png"}, body: large},
+		{name: "svg", accept: "gzip", header: map[string]string{"Content-Type": "image/svg+xml"}, body: large, coding: "gzip"},
+		{name: "zip", accept: "gzip", header: map[string]string{"Content-Type": "application/zip"}, body: large},
+		{name: "already encoded", accept: "gzip", header: map[string]string{"Content-Encoding": "identity"}, body: large, coding: "identity"},
+		{name: "partial content", accept: "gzip", status: http.StatusPartialContent, body: large},
+		{name: "created", accept: "gzip", status: http.StatusCreated, body: large, coding: "gzip"},
+		{name: "custom encoder", opts: CompressOptions{Encoders: map[string]Encoder{"br": upperEncoder}}, accept: "gzip, br", body: large, coding: "br"},
+		{name: "replaced encoder", opts: CompressOptions{Encoders: map[string]Encoder{"gzip": nil}}, accept: "gzip", body: large},
+		{name: "custom preference", opts: CompressOptions{Preference: []string{"deflate", "gzip"}}, accept: "gzip, deflate", body: large, coding: "deflate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := Compress(tt.opts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for k, v := range tt.header {
+					w.Header().Set(k, v)
+				}
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+				}
+				// write in pieces, below the min size
+				for b := []byte(tt.body); len(b) > 0; b = b[min(100, len(b)):] {
+					w.Write(b[:min(100, len(b))])
+				}
+			}))
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept-Encoding", tt.accept)
+			}
+			h.ServeHTTP(w, r)
+
+			if tt.status == 0 {
+				tt.status = http.StatusOK
+			}
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("Vary = %q, want Accept-Encoding", got)
+			}
+			if got := w.Header().Get("Content-Encoding"); got != tt.coding {
+				t.Fatalf("Content-Encoding = %q, want %q", got, tt.coding)
+			}
+			coding := tt.coding
+			if coding == "identity" {
+				coding = ""
+			}
+			if coding != "" {
+				if cl := w.Header().Get("Content-Length"); cl != "" {
+					t.Errorf("Content-Length = %s, want none", cl)
+				}
+			}
+			if coding == "gzip" && w.Body.Len() >= len(tt.body) && len(tt.body) > 1024 {
+				t.Errorf("body is %d bytes, want less than %d", w.Body.Len(), len(tt.body))
+			}
+			if got := decodeBody(t, coding, w.Body.Bytes()); got != tt.body {
+				t.Errorf("decoded body = %.20q, want %.20q", got, tt.body)
+			}
+		})
+	}
+}
+
+func TestCompressHead(t *testing.T) {
+	body := strings.Repeat("way ", 512)
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		coding  string
+	}{
+		{
+			name: "body",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, body)
+			},
+			coding: "gzip",
+		},
+		{
+			name: "declared length",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+				if r.Method != http.MethodHead {
+					io.WriteString(w, body)
+				}
+			},
+			coding: "gzip",
+		},
+		{
+			name: "small",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.Header().Set("Content-Length", "5")
+				if r.Method != http.MethodHead {
+					io.WriteString(w, "small")
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := Compress(CompressOptions{})(tt.handler)
+			var headers [2]http.Header
+			for i, method := range []string{http.MethodGet, http.MethodHead} {
+				w := httptest.NewRecorder()
+				r := httptest.NewRequest(method, "/", nil)
+				r.Header.Set("Accept-Encoding", "gzip")
+				h.ServeHTTP(w, r)
+				headers[i] = w.Header()
+				if method == http.MethodHead && w.Body.Len() > 0 {
+					t.Errorf("HEAD body is %d bytes, want none", w.Body.Len())
+				}
+			}
+			for _, k := range []string{"Content-Encoding", "Content-Length", "Content-Type", "Vary"} {
+				if get, head := headers[0].Get(k), headers[1].Get(k); get != head {
+					t.Errorf("%s: GET %q, HEAD %q", k, get, head)
+				}
+			}
+			if got := headers[1].Get("Content-Encoding"); got != tt.coding {
+				t.Errorf("Content-Encoding = %q, want %q", got, tt.coding)
+			}
+		})
+	}
+}
+
+func TestCompressFlush(t *testing.T) {
+	h := Compress(CompressOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "event: 1\n\n")
+		w.(http.Flusher).Flush()
+	}))
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	h.ServeHTTP(w, r)
+	if !w.Flushed {
+		t.Error("the underlying writer was not flushed")
+	}
+	// streaming responses are compressed regardless of size
+	if got := w.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", got)
+	}
+	if got := decodeBody(t, "gzip", w.Body.Bytes()); got != "event: 1\n\n" {
+		t.Errorf("body = %q", got)
+	}
+}
+
+func TestCompressHijack(t *testing.T) {
+	var hijacked bool
+	h := Compress(CompressOptions{MinSize: 1})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hj, ok := w.(http.Hijacker)
+		if hijacked = ok; !ok {
+			return
+		}
+		conn, _, err := hj.Hijack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+
+	w := &hijackRecorder{ResponseRecorder: httptest.NewRecorder()}
+	h.ServeHTTP(w, r)
+	if !hijacked || !w.hijacked {
+		t.Fatal("Hijack was not passed through")
+	}
+	if w.Body.Len() > 0 || w.Header().Get("Content-Encoding") != "" {
+		t.Errorf("hijacked response was written: %q %v", w.Body, w.Header())
+	}
+
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if hijacked {
+		t.Error("the writer implements http.Hijacker without an underlying one")
+	}
+}
@@ -0,0 +1,220 @@
+package way
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"html/template"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// csrfContextKey is the context key type for storing
+// the CSRF token of a request in context.Context.
+type csrfContextKey struct{}
+
+// csrfTokenLen is the length in bytes of raw CSRF tokens.
+const csrfTokenLen = 32
+
+// CSRFStore keeps synchronizer tokens server-side, usually in the
+// session of the user.
+type CSRFStore interface {
+	// Token returns the token stored for the session of r,
+	// or "" if there is none.
+	Token(r *http.Request) (string, error)
+	// SetToken stores the token for the session of r.
+	SetToken(w http.ResponseWriter, r *http.Request, token string) error
+}
+
+// CSRFOptions configures the CSRF middleware.
+type CSRFOptions struct {
+	// Store keeps the synchronizer token of each session. If nil,
+	// the double-submit cookie pattern is used instead: the token
+	// is kept in Cookie.
+	Store CSRFStore
+	// Cookie is the template of the double-submit cookie. If its
+	// Name is empty, the cookie is "csrf_token" with Path "/",
+	// HttpOnly and SameSite Lax, keeping only Secure. Set HttpOnly
+	// to false if JavaScript sends the token, reading it from the cookie.
+	Cookie http.Cookie
+	// Key, if set, signs double-submit cookies, so that a cookie
+	// planted by a sibling subdomain is rejected.
+	Key []byte
+	// Header is the request header carrying the token.
+	// By default "X-CSRF-Token".
+	Header string
+	// Field is the form field carrying the token when the header
+	// is absent. By default "csrf_token".
+	Field string
+	// ErrorHandler is the http.Handler to call when the token is
+	// missing or invalid. If nil, a 403 Problem is rendered instead.
+	ErrorHandler http.Handler
+}
+
+// csrfState is the CSRF token of a request, with the field it
+// is expected in.
+type csrfState struct {
+	token []byte
+	field string
+}
+
+// CSRF returns a Middleware protecting from cross-site request
+// forgery. Requests with methods other than GET, HEAD, OPTIONS and
+// TRACE must carry the token of the user in the header or form field,
+// which handlers get with CSRFToken or CSRFField to put in pages.
+func CSRF(opts CSRFOptions) Middleware {
+	if opts.Cookie.Name == "" {
+		opts.Cookie = http.Cookie{Name: "csrf_token", Path: "/", HttpOnly: true, SameSite: http.SameSiteLaxMode, Secure: opts.Cookie.Secure}
+	}
+	if opts.Header == "" {
+		opts.Header = "X-CSRF-Token"
+	}
+	if opts.Field == "" {
+		opts.Field = "csrf_token"
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, err := opts.token(w, r)
+			if err != nil {
+				RenderError(w, r, NewProblem(http.StatusInternalServerError, ""))
+				return
+			}
+			r = r.WithContext(context.WithValue(r.Context(), csrfContextKey{}, &csrfState{token: token, field: opts.Field}))
+			w.Header().Add("Vary", "Cookie")
+
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+				next.ServeHTTP(w, r)
+				return
+			}
+			sent := r.Header.Get(opts.Header)
+			if sent == "" && isForm(r) {
+				sent = r.PostFormValue(opts.Field)
+			}
+			if !csrfValid(token, sent) {
+				if opts.ErrorHandler != nil {
+					opts.ErrorHandler.ServeHTTP(w, r)
+					return
+				}
+				RenderError(w, r, NewProblem(http.StatusForbidden, "The CSRF token is missing or invalid."))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// token gets the raw token of the user, making a new one if needed.
+func (opts *CSRFOptions) token(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	if opts.Store != nil {
+		stored, err := opts.Store.Token(r)
+		if err != nil {
+			return nil, err
+		}
+		if token, err := base64.RawURLEncoding.DecodeString(stored); err == nil && len(token) == csrfTokenLen {
+			return token, nil
+		}
+		token := newCSRFToken()
+		return token, opts.Store.SetToken(w, r, base64.RawURLEncoding.EncodeToString(token))
+	}
+
+	if c, err := r.Cookie(opts.Cookie.Name); err == nil {
+		if token, ok := opts.unsign(c.Value); ok {
+			return token, nil
+		}
+	}
+	token := newCSRFToken()
+	c := opts.Cookie
+	c.Value = opts.sign(token)
+	http.SetCookie(w, &c)
+	return token, nil
+}
+
+// sign encodes a token for the double-submit cookie.
+func (opts *CSRFOptions) sign(token []byte) string {
+	v := base64.RawURLEncoding.EncodeToString(token)
+	if opts.Key == nil {
+		return v
+	}
+	mac := hmac.New(sha256.New, opts.Key)
+	mac.Write(token)
+	return v + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// unsign decodes a double-submit cookie, checking its signature.
+func (opts *CSRFOptions) unsign(v string) ([]byte, bool) {
+	v, sig, signed := strings.Cut(v, ".")
+	token, err := base64.RawURLEncoding.DecodeString(v)
+	if err != nil || len(token) != csrfTokenLen || signed != (opts.Key != nil) {
+		return nil, false
+	}
+	if opts.Key == nil {
+		return token, true
+	}
+	mac := hmac.New(sha256.New, opts.Key)
+	mac.Write(token)
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	return token, err == nil && hmac.Equal(got, mac.Sum(nil))
+}
+
+func newCSRFToken() []byte {
+	token := make([]byte, csrfTokenLen)
+	rand.Read(token)
+	return token
+}
+
+// csrfValid checks a token sent with a request, either raw as read by
+// JavaScript from the cookie, or masked as given by CSRFToken.
+func csrfValid(token []byte, sent string) bool {
+	// tolerate padding added by clients
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(sent, "="))
+	switch {
+	case err != nil:
+		return false
+	case len(b) == 2*csrfTokenLen:
+		b = xorBytes(b[:csrfTokenLen], b[csrfTokenLen:])
+	case len(b) != csrfTokenLen:
+		return false
+	}
+	return subtle.ConstantTimeCompare(token, b) == 1
+}
+
+// isForm reports whether r has a form body.
+func isForm(r *http.Request) bool {
+	mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mt == "application/x-www-form-urlencoded" || mt == "multipart/form-data"
+}
+
+func xorBytes(a, b []byte) []byte {
+	out := make([]byte, len(a))
+	subtle.XORBytes(out, a, b)
+	return out
+}
+
+// CSRFToken gets the CSRF token to send with requests from the
+// specified Context. It is masked differently each time, so it does
+// not leak through compressed responses (BREACH). Returns "" if the
+// CSRF middleware did not run.
+func CSRFToken(ctx context.Context) string {
+	s, ok := ctx.Value(csrfContextKey{}).(*csrfState)
+	if !ok {
+		return ""
+	}
+	pad := newCSRFToken()
+	return base64.RawURLEncoding.EncodeToString(append(pad, xorBytes(pad, s.token)...))
+}
+
+// CSRFField gets a hidden form input carrying the CSRF token from the
+// specified Context, for html/template.
+func CSRFField(ctx context.Context) template.HTML {
+	s, ok := ctx.Value(csrfContextKey{}).(*csrfState)
+	if !ok {
+		return ""
+	}
+	return template.HTML(`<input type="hidden" name="` + template.HTMLEscapeString(s.field) +
+		`" value="` + CSRFToken(ctx) + `">`)
+}
@@ -0,0 +1,173 @@
+package way
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// memoryCSRFStore is a CSRFStore with a single session.
+type memoryCSRFStore struct{ token string }
+
+func (s *memoryCSRFStore) Token(r *http.Request) (string, error) { return s.token, nil }
+
+func (s *memoryCSRFStore) SetToken(w http.ResponseWriter, r *http.Request, token string) error {
+	s.token = token
+	return nil
+}
+
+// csrfRouter serves a page with the CSRF token and a form target.
+func csrfRouter(opts CSRFOptions) *Router {
+	rtr := NewRouter()
+	rtr.Use(CSRF(opts))
+	rtr.GET("/form", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, CSRFToken(r.Context()))
+	}))
+	rtr.POST("/form", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	return rtr
+}
+
+func TestCSRF(t *testing.T) {
+	// a valid but different token, as planted by an attacker
+	planted := base64.RawURLEncoding.EncodeToString(make([]byte, csrfTokenLen))
+
+	tests := []struct {
+		name string
+		opts CSRFOptions
+		// send prepares the POST request from the cookie and
+		// the token of the page
+		send   func(r *http.Request, cookie *http.Cookie, token string)
+		status int
+	}{
+		{
+			name: "header",
+			send: func(r *http.Request, c *http.Cookie, token string) {
+				r.AddCookie(c)
+				r.Header.Set("X-CSRF-Token", token)
+			},
+			status: http.StatusOK,
+		},
+		{
+			name: "form field",
+			send: func(r *http.Request, c *http.Cookie, token string) {
+				r.AddCookie(c)
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+				r.Body = io.NopCloser(strings.NewReader(url.Values{"csrf_token": {token}}.Encode()))
+			},
+			status: http.StatusOK,
+		},
+		{
+			name: "raw token read from the cookie",
+			opts: CSRFOptions{Cookie: http.Cookie{Name: "xsrf", Path: "/"}, Header: "X-XSRF-Token"},
+			send: func(r *http.Request, c *http.Cookie, token string) {
+				r.AddCookie(c)
+				r.Header.Set("X-XSRF-Token", c.Value)
+			},
+			status: http.StatusOK,
+		},
+		{
+			name: "no token",
+			send: func(r *http.Request, c *http.Cookie, token string) {
+				r.AddCookie(c)
+			},
+			status: http.StatusForbidden,
+		},
+		{
+			name: "no cookie",
+			send: func(r *http.Request, c *http.Cookie, token string) {
+				r.Header.Set("X-CSRF-Token", token)
+			},
+			status: http.StatusForbidden,
+		},
+		// without a Key, a cookie planted by a sibling subdomain passes
+		{
+			name: "planted cookie",
+			send: func(r *http.Request, c *http.Cookie, token string) {
+				r.AddCookie(&http.Cookie{Name: c.Name, Value: planted})
+				r.Header.Set("X-CSRF-Token", planted)
+			},
+			status: http.StatusOK,
+		},
+		{
+			name: "planted cookie with a key",
+			opts: CSRFOptions{Key: []byte("key")},
+			send: func(r *http.Request, c *http.Cookie, token string) {
+				r.AddCookie(&http.Cookie{Name: c.Name, Value: planted})
+				r.Header.Set("X-CSRF-Token", planted)
+			},
+			status: http.StatusForbidden,
+		},
+		{
+			name: "signed cookie",
+			opts: CSRFOptions{Key: []byte("key")},
+			send: func(r *http.Request, c *http.Cookie, token string) {
+				r.AddCookie(c)
+				r.Header.Set("X-CSRF-Token", token)
+			},
+			status: http.StatusOK,
+		},
+		{
+			name: "cookie signed with another key",
+			opts: CSRFOptions{Key: []byte("key")},
+			send: func(r *http.Request, c *http.Cookie, token string) {
+				other := CSRFOptions{Key: []byte("other")}
+				r.AddCookie(&http.Cookie{Name: c.Name, Value: other.sign(make([]byte, csrfTokenLen))})
+				r.Header.Set("X-CSRF-Token", planted)
+			},
+			status: http.StatusForbidden,
+		},
+		{
+			name: "store",
+			opts: CSRFOptions{Store: &memoryCSRFStore{}},
+			send: func(r *http.Request, c *http.Cookie, token string) {
+				r.Header.Set("X-CSRF-Token", token)
+			},
+			status: http.StatusOK,
+		},
+		{
+			name: "store with a wrong token",
+			opts: CSRFOptions{Store: &memoryCSRFStore{}},
+			send: func(r *http.Request, c *http.Cookie, token string) {
+				r.Header.Set("X-CSRF-Token", planted)
+			},
+			status: http.StatusForbidden,
+		},
+		{
+			name: "error handler",
+			opts: CSRFOptions{ErrorHandler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusTeapot)
+			})},
+			send:   func(r *http.Request, c *http.Cookie, token string) {},
+			status: http.StatusTeapot,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rtr := csrfRouter(tt.opts)
+			w := httptest.NewRecorder()
+			rtr.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/form", nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("GET status = %d, want 200", w.Code)
+			}
+			token := w.Body.String()
+			cookie := &http.Cookie{Name: "csrf_token"}
+			if cookies := w.Result().Cookies(); len(cookies) > 0 {
+				cookie = cookies[0]
+			} else if tt.opts.Store == nil {
+				t.Fatal("no CSRF cookie was set")
+			}
+
+			w = httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/form", nil)
+			tt.send(r, cookie, token)
+			rtr.ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Errorf("POST status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package way
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileOptions configures Router.ServeFiles.
+type FileOptions struct {
+	// ListDirectories enables listings of directories without an
+	// index.html. By default such directories are not found.
+	ListDirectories bool
+	// Fallback is the file served for paths under the prefix that
+	// do not exist, e.g. "index.html" for a single-page app routing
+	// on the client. By default such paths are not found.
+	Fallback string
+	// CacheControl is the Cache-Control header sent with files,
+	// e.g. "public, max-age=3600". By default none is sent.
+	CacheControl string
+}
+
+// ServeFiles serves the files of fsys under the path prefix for GET
+// and HEAD requests, e.g. ServeFiles("/static/", os.DirFS("public"),
+// FileOptions{}) serves public/css/site.css at /static/css/site.css.
+// Files are sent with an ETag derived from their content and a
+// Last-Modified header when fsys reports modification times, and
+// conditional and range requests are honoured. When the client
+// accepts it, a precompressed variant such as site.css.br or
+// site.css.gz is sent in place of the file. Route options configure
+// the route registered for the prefix.
+func (rtr *Router) ServeFiles(prefix string, fsys fs.FS, opts FileOptions, routeOpts ...RouteOption) {
+	base := strings.TrimSuffix(prefix, "/")
+	fh := &fileHandler{fsys: fsys, base: base, opts: opts}
+	rtr.Handle(WAY_GET|WAY_HEAD, base+"/...", fh, routeOpts...)
+}
+
+type fileHandler struct {
+	fsys fs.FS
+	base string
+	opts FileOptions
+
+	etags sync.Map // fileKey -> string
+}
+
+// fileKey identifies a version of a file for caching its ETag.
+type fileKey struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+// precompressed lists the encodings of precompressed variants,
+// in order of preference, with their file extensions.
+var precompressed = []struct {
+	encoding string
+	ext      string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+func (fh *fileHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := path.Clean("/" + strings.TrimPrefix(r.URL.Path, fh.base))
+	name = strings.TrimPrefix(name, "/")
+	if name == "" {
+		name = "."
+	}
+
+	info, err := fs.Stat(fh.fsys, name)
+	if err == nil && info.IsDir() {
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			redirectSlash(w, r)
+			return
+		}
+		index := path.Join(name, "index.html")
+		if indexInfo, err := fs.Stat(fh.fsys, index); err == nil && !indexInfo.IsDir() {
+			fh.serveFile(w, r, index, indexInfo)
+			return
+		}
+		if fh.opts.ListDirectories {
+			fh.listDirectory(w, r, name)
+			return
+		}
+		err = fs.ErrNotExist
+	}
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			RenderError(w, r, NewProblem(http.StatusInternalServerError, ""))
+			return
+		}
+		if fh.opts.Fallback != "" {
+			if info, err := fs.Stat(fh.fsys, fh.opts.Fallback); err == nil && !info.IsDir() {
+				fh.serveFile(w, r, fh.opts.Fallback, info)
+				return
+			}
+		}
+		RenderError(w, r, NewProblem(http.StatusNotFound, ""))
+		return
+	}
+	fh.serveFile(w, r, name, info)
+}
+
+// serveFile sends the file name, or one of its precompressed variants.
+func (fh *fileHandler) serveFile(w http.ResponseWriter, r *http.Request, name string, info fs.FileInfo) {
+	h := w.Header()
+	if ct := mime.TypeByExtension(path.Ext(name)); ct != "" {
+		h.Set("Content-Type", ct)
+	}
+	if fh.opts.CacheControl != "" {
+		h.Set("Cache-Control", fh.opts.CacheControl)
+	}
+
+	served := name
+	h.Add("Vary", "Accept-Encoding")
+	accept := r.Header.Get("Accept-Encoding")
+	for _, pc := range precompressed {
+		if !acceptsEncoding(accept, pc.encoding) {
+			continue
+		}
+		if pcInfo, err := fs.Stat(fh.fsys, name+pc.ext); err == nil && !pcInfo.IsDir() {
+			if h.Get("Content-Type") == "" {
+				// don't let ServeContent sniff the compressed bytes
+				h.Set("Content-Type", "application/octet-stream")
+			}
+			h.Set("Content-Encoding", pc.encoding)
+			served, info = name+pc.ext, pcInfo
+			break
+		}
+	}
+
+	f, err := fh.fsys.Open(served)
+	if err != nil {
+		RenderError(w, r, NewProblem(http.StatusInternalServerError, ""))
+		return
+	}
+	defer f.Close()
+
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			RenderError(w, r, NewProblem(http.StatusInternalServerError, ""))
+			return
+		}
+		content = bytes.NewReader(data)
+	}
+	etag, err := fh.etag(served, info, content)
+	if err != nil {
+		RenderError(w, r, NewProblem(http.StatusInternalServerError, ""))
+		return
+	}
+	h.Set("ETag", etag)
+	http.ServeContent(w, r, name, info.ModTime(), content)
+}
+
+// etag returns the ETag of a file, hashing its content
+// the first time each version of the file is served.
+func (fh *fileHandler) etag(name string, info fs.FileInfo, content io.ReadSeeker) (string, error) {
+	key := fileKey{name: name, size: info.Size(), modTime: info.ModTime()}
+	if etag, ok := fh.etags.Load(key); ok {
+		return etag.(string), nil
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, content); err != nil {
+		return "", err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	etag := `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+	fh.etags.Store(key, etag)
+	return etag, nil
+}
+
+func (fh *fileHandler) listDirectory(w http.ResponseWriter, r *http.Request, name string) {
+	entries, err := fs.ReadDir(fh.fsys, name)
+	if err != nil {
+		RenderError(w, r, NewProblem(http.StatusInternalServerError, ""))
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<!DOCTYPE html>\n<html><head><title>%s</title></head>\n<body><pre>\n", html.EscapeString(r.URL.Path))
+	for _, e := range entries {
+		n := e.Name()
+		if e.IsDir() {
+			n += "/"
+		}
+		u := url.URL{Path: n}
+		fmt.Fprintf(w, "<a href=\"%s\">%s</a>\n", u.String(), html.EscapeString(n))
+	}
+	fmt.Fprint(w, "</pre></body></html>\n")
+}
+
+// redirectSlash redirects to the request path with a trailing slash.
+func redirectSlash(w http.ResponseWriter, r *http.Request) {
+	u := *r.URL
+	u.Path += "/"
+	http.Redirect(w, r, u.RequestURI(), http.StatusMovedPermanently)
+}
+
+// acceptsEncoding reports whether the Accept-Encoding header
+// accepts the content coding enc with a non-zero q-value.
+func acceptsEncoding(accept, enc string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.TrimSpace(coding)
+		if !strings.EqualFold(coding, enc) && coding != "*" {
+			continue
+		}
+		k, v, _ := strings.Cut(strings.TrimSpace(params), "=")
+		if strings.TrimSpace(k) == "q" && strings.Trim(strings.TrimSpace(v), "0.") == "" {
+			return false
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,181 @@
+package way
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+var testFiles = fstest.MapFS{
+	"index.html":         {Data: []byte("home")},
+	"css/site.css":       {Data: []byte("body{}")},
+	"css/site.css.br":    {Data: []byte("brotli")},
+	"css/site.css.gz":    {Data: []byte("gzipped")},
+	"js/app.js":          {Data: []byte("app()")},
+	"js/app.js.gz":       {Data: []byte("gzipped app")},
+	"docs/index.html":    {Data: []byte("docs")},
+	"images/logo.png":    {Data: []byte("png")},
+	"images/icons/a.png": {Data: []byte("a")},
+}
+
+func TestServeFiles(t *testing.T) {
+	plain := NewRouter()
+	plain.ServeFiles("/static/", testFiles, FileOptions{CacheControl: "public, max-age=60"})
+	listing := NewRouter()
+	listing.ServeFiles("/static/", testFiles, FileOptions{ListDirectories: true})
+	spa := NewRouter()
+	spa.ServeFiles("/app", testFiles, FileOptions{Fallback: "index.html"})
+
+	tests := []struct {
+		name     string
+		rtr      *Router
+		path     string
+		status   int
+		want     string
+		location string
+	}{
+		{name: "file", rtr: plain, path: "/static/css/site.css", status: http.StatusOK, want: "body{}"},
+		{name: "prefix index", rtr: plain, path: "/static/", status: http.StatusOK, want: "home"},
+		{name: "directory index", rtr: plain, path: "/static/docs/", status: http.StatusOK, want: "docs"},
+		{name: "directory redirect", rtr: plain, path: "/static/docs?v=1", status: http.StatusMovedPermanently, location: "/static/docs/?v=1"},
+		{name: "prefix redirect", rtr: plain, path: "/static", status: http.StatusMovedPermanently, location: "/static/"},
+		{name: "dot-dot stays under prefix", rtr: plain, path: "/static/css/../js/app.js", status: http.StatusOK, want: "app()"},
+		{name: "missing", rtr: plain, path: "/static/missing.txt", status: http.StatusNotFound},
+		{name: "listing off", rtr: plain, path: "/static/images/", status: http.StatusNotFound},
+		{name: "listing on", rtr: listing, path: "/static/images/", status: http.StatusOK, want: `<a href="icons/">icons/</a>` + "\n" + `<a href="logo.png">logo.png</a>`},
+		{name: "listing on with index", rtr: listing, path: "/static/docs/", status: http.StatusOK, want: "docs"},
+		{name: "fallback", rtr: spa, path: "/app/songs/7", status: http.StatusOK, want: "home"},
+		{name: "fallback existing file", rtr: spa, path: "/app/js/app.js", status: http.StatusOK, want: "app()"},
+		{name: "fallback for directory without index", rtr: spa, path: "/app/images/", status: http.StatusOK, want: "home"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tt.rtr.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if !strings.Contains(w.Body.String(), tt.want) {
+				t.Errorf("body %q does not contain %q", w.Body, tt.want)
+			}
+			if got := w.Header().Get("Location"); got != tt.location {
+				t.Errorf("Location = %q, want %q", got, tt.location)
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	plain.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/static/css/site.css", nil))
+	if got := w.Header().Get("Cache-Control"); got != "public, max-age=60" {
+		t.Errorf("Cache-Control = %q", got)
+	}
+	if got := w.Header().Get("Content-Type"); got != "text/css; charset=utf-8" {
+		t.Errorf("Content-Type = %q", got)
+	}
+}
+
+func TestServeFilesETag(t *testing.T) {
+	rtr := NewRouter()
+	rtr.ServeFiles("/static/", testFiles, FileOptions{})
+
+	w := httptest.NewRecorder()
+	rtr.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/static/js/app.js", nil))
+	etag := w.Header().Get("ETag")
+	if len(etag) != 34 || etag[0] != '"' || etag[33] != '"' {
+		t.Fatalf("ETag = %q, want a quoted hash", etag)
+	}
+
+	other := httptest.NewRecorder()
+	rtr.ServeHTTP(other, httptest.NewRequest(http.MethodGet, "/static/css/site.css", nil))
+	if other.Header().Get("ETag") == etag {
+		t.Errorf("files with different content share the ETag %s", etag)
+	}
+
+	tests := []struct {
+		name        string
+		method      string
+		ifNoneMatch string
+		status      int
+	}{
+		{name: "matching", method: http.MethodGet, ifNoneMatch: etag, status: http.StatusNotModified},
+		{name: "matching in list", method: http.MethodGet, ifNoneMatch: `"other", ` + etag, status: http.StatusNotModified},
+		{name: "any", method: http.MethodGet, ifNoneMatch: "*", status: http.StatusNotModified},
+		{name: "head", method: http.MethodHead, ifNoneMatch: etag, status: http.StatusNotModified},
+		{name: "stale", method: http.MethodGet, ifNoneMatch: `"other"`, status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(tt.method, "/static/js/app.js", nil)
+			r.Header.Set("If-None-Match", tt.ifNoneMatch)
+			rtr.ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if got := w.Header().Get("ETag"); got != etag {
+				t.Errorf("ETag = %q, want %q", got, etag)
+			}
+			if tt.status == http.StatusNotModified && w.Body.Len() != 0 {
+				t.Errorf("body = %q, want none", w.Body)
+			}
+		})
+	}
+}
+
+func TestServeFilesPrecompressed(t *testing.T) {
+	rtr := NewRouter()
+	rtr.ServeFiles("/static/", testFiles, FileOptions{})
+
+	tests := []struct {
+		name           string
+		path           string
+		acceptEncoding string
+		encoding       string
+		want           string
+	}{
+		{name: "brotli preferred", path: "/static/css/site.css", acceptEncoding: "gzip, br", encoding: "br", want: "brotli"},
+		{name: "gzip", path: "/static/css/site.css", acceptEncoding: "gzip", encoding: "gzip", want: "gzipped"},
+		{name: "brotli refused", path: "/static/css/site.css", acceptEncoding: "br;q=0, gzip", encoding: "gzip", want: "gzipped"},
+		{name: "zero q-value with decimals", path: "/static/css/site.css", acceptEncoding: "br;q=0.000, gzip;q=0.5", encoding: "gzip", want: "gzipped"},
+		{name: "all refused", path: "/static/css/site.css", acceptEncoding: "br;q=0, gzip;q=0", want: "body{}"},
+		{name: "wildcard", path: "/static/css/site.css", acceptEncoding: "*", encoding: "br", want: "brotli"},
+		{name: "wildcard refused", path: "/static/css/site.css", acceptEncoding: "*;q=0", want: "body{}"},
+		{name: "case-insensitive", path: "/static/css/site.css", acceptEncoding: "GZIP", encoding: "gzip", want: "gzipped"},
+		{name: "not accepted", path: "/static/css/site.css", want: "body{}"},
+		{name: "no brotli variant", path: "/static/js/app.js", acceptEncoding: "br, gzip", encoding: "gzip", want: "gzipped app"},
+		{name: "no variant", path: "/static/images/logo.png", acceptEncoding: "br, gzip", want: "png"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.acceptEncoding != "" {
+				r.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			rtr.ServeHTTP(w, r)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			if got := w.Header().Get("Content-Encoding"); got != tt.encoding {
+				t.Errorf("Content-Encoding = %q, want %q", got, tt.encoding)
+			}
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("body = %q, want %q", got, tt.want)
+			}
+			if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("Vary = %q, want Accept-Encoding", got)
+			}
+		})
+	}
+
+	// the type is that of the original file, not of the variant
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/static/css/site.css", nil)
+	r.Header.Set("Accept-Encoding", "br")
+	rtr.ServeHTTP(w, r)
+	if got := w.Header().Get("Content-Type"); got != "text/css; charset=utf-8" {
+		t.Errorf("Content-Type = %q", got)
+	}
+}
@@ -0,0 +1,73 @@
+package way
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Group registers routes sharing a path prefix and route options,
+// such as middleware added with With.
+type Group struct {
+	rtr    *Router
+	prefix string
+	opts   []RouteOption
+}
+
+// Group makes a Group of routes under the path prefix. The options
+// apply to every route of the group, before the route's own options.
+func (rtr *Router) Group(prefix string, opts ...RouteOption) *Group {
+	return &Group{rtr: rtr, prefix: strings.TrimSuffix(prefix, "/"), opts: opts}
+}
+
+// Group makes a nested Group, adding to the prefix and options of g.
+func (g *Group) Group(prefix string, opts ...RouteOption) *Group {
+	return &Group{
+		rtr:    g.rtr,
+		prefix: g.prefix + strings.TrimSuffix(prefix, "/"),
+		opts:   append(g.opts[:len(g.opts):len(g.opts)], opts...),
+	}
+}
+
+// Handle adds a handler with the specified method and pattern,
+// relative to the prefix of the group. See Router.Handle.
+func (g *Group) Handle(methods int, pattern string, handler http.Handler, opts ...RouteOption) {
+	full := g.prefix + pattern
+	if pattern == "/" || pattern == "" {
+		// the root of the group, not a prefix route
+		full = g.prefix
+	}
+	if full == "" {
+		full = "/"
+	}
+	g.rtr.Handle(methods, full, handler, append(g.opts[:len(g.opts):len(g.opts)], opts...)...)
+}
+
+// ALL ...
+func (g *Group) ALL(pattern string, handler http.Handler, opts ...RouteOption) {
+	g.Handle(WAY_WILDCARD, pattern, handler, opts...)
+}
+
+// GET ...
+func (g *Group) GET(pattern string, handler http.Handler, opts ...RouteOption) {
+	g.Handle(WAY_GET, pattern, handler, opts...)
+}
+
+// HEAD ...
+func (g *Group) HEAD(pattern string, handler http.Handler, opts ...RouteOption) {
+	g.Handle(WAY_HEAD, pattern, handler, opts...)
+}
+
+// POST ...
+func (g *Group) POST(pattern string, handler http.Handler, opts ...RouteOption) {
+	g.Handle(WAY_POST, pattern, handler, opts...)
+}
+
+// PUT ...
+func (g *Group) PUT(pattern string, handler http.Handler, opts ...RouteOption) {
+	g.Handle(WAY_PUT, pattern, handler, opts...)
+}
+
+// DELETE ...
+func (g *Group) DELETE(pattern string, handler http.Handler, opts ...RouteOption) {
+	g.Handle(WAY_DELETE, pattern, handler, opts...)
+}
@@ -0,0 +1,110 @@
+package way
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+)
+
+// Validatable is implemented by request types that
+// can check themselves once bound.
+type Validatable interface {
+	Validate() error
+}
+
+// JSON adapts fn to an http.Handler for JSON APIs. The request is
+// decoded into a Req: the JSON body first, then the fields tagged
+// for Bind. If Req implements Validatable it is validated, then fn is
+// called and its Resp encoded as the JSON response body.
+//
+// Errors are rendered with RenderError: a *Problem returned by fn
+// or Validate is rendered as is, any other error from Validate as
+// 400 and any other error from fn as 500, hiding its message.
+func JSON[Req, Resp any](fn func(ctx context.Context, req Req) (Resp, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req Req
+		if err := decodeJSON(r, &req); err != nil {
+			RenderError(w, r, problemFrom(err, http.StatusBadRequest))
+			return
+		}
+		v, ok := any(&req).(Validatable)
+		if !ok {
+			// Req may be a pointer to the type implementing it
+			v, ok = any(req).(Validatable)
+		}
+		if ok {
+			if err := v.Validate(); err != nil {
+				RenderError(w, r, problemFrom(err, http.StatusBadRequest))
+				return
+			}
+		}
+
+		resp, err := fn(r.Context(), req)
+		if err != nil {
+			var p *Problem
+			if !errors.As(err, &p) {
+				p = NewProblem(http.StatusInternalServerError, "")
+			}
+			RenderError(w, r, p)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	})
+}
+
+// decodeJSON decodes the JSON body of r, if any, into dst and, if
+// it is a struct, binds the path parameters and query string.
+func decodeJSON(r *http.Request, dst any) error {
+	if r.Body != nil && r.Body != http.NoBody {
+		if ct := r.Header.Get("Content-Type"); ct != "" && !isJSON(ct) {
+			return NewProblem(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+		}
+		if err := json.NewDecoder(r.Body).Decode(dst); err != nil && err != io.EOF {
+			var mbe *http.MaxBytesError
+			if errors.As(err, &mbe) {
+				return bodyError(err)
+			}
+			return NewProblem(http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		}
+	}
+	// only structs have fields to bind, possibly behind pointers
+	v := reflect.ValueOf(dst).Elem()
+	t := v.Type()
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	if err := Bind(r, v.Addr().Interface()); err != nil {
+		var be BindError
+		if !errors.As(err, &be) {
+			return err
+		}
+		p := NewProblem(http.StatusBadRequest, "The request parameters are invalid.")
+		p.Extensions = map[string]any{"errors": be}
+		return p
+	}
+	return nil
+}
+
+// problemFrom returns err as a *Problem, wrapping
+// errors that are not one with the specified status.
+func problemFrom(err error, status int) *Problem {
+	var p *Problem
+	if errors.As(err, &p) {
+		return p
+	}
+	return NewProblem(status, err.Error())
+}
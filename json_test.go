@@ -0,0 +1,79 @@
+package way
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type readSong struct {
+	Band  string `path:"band"`
+	Lyric bool   `query:"lyrics"`
+	Title string `json:"title"`
+}
+
+func (s *readSong) Validate() error {
+	if s.Band == "nobody" {
+		return errors.New("unknown band")
+	}
+	return nil
+}
+
+func TestJSON(t *testing.T) {
+	echo := func(ctx context.Context, req readSong) (readSong, error) {
+		if req.Band == "broken" {
+			return req, errors.New("database is down")
+		}
+		if req.Band == "banned" {
+			return req, NewProblem(http.StatusForbidden, "Banned.")
+		}
+		return req, nil
+	}
+	rtr := NewRouter()
+	rtr.POST("/struct/:band", JSON(echo))
+	rtr.POST("/pointer/:band", JSON(func(ctx context.Context, req *readSong) (*readSong, error) { return req, nil }))
+	rtr.POST("/slice", JSON(func(ctx context.Context, req []int) (int, error) { return len(req), nil }))
+	rtr.POST("/map", JSON(func(ctx context.Context, req map[string]int) (int, error) { return req["a"], nil }))
+
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		body        string
+		status      int
+		want        string
+	}{
+		{name: "struct", path: "/struct/queen?lyrics=true", body: `{"title":"Bohemian"}`, status: http.StatusOK, want: `{"Band":"queen","Lyric":true,"title":"Bohemian"}`},
+		{name: "no body", path: "/struct/queen", status: http.StatusOK, want: `{"Band":"queen","Lyric":false,"title":""}`},
+		{name: "invalid query", path: "/struct/queen?lyrics=maybe", status: http.StatusBadRequest, want: "parameters are invalid"},
+		{name: "invalid JSON", path: "/struct/queen", body: `{"title":`, status: http.StatusBadRequest},
+		{name: "not JSON", path: "/struct/queen", contentType: "text/plain", body: "title", status: http.StatusUnsupportedMediaType},
+		{name: "validation", path: "/struct/nobody", status: http.StatusBadRequest, want: "unknown band"},
+		{name: "handler error", path: "/struct/broken", status: http.StatusInternalServerError},
+		{name: "handler problem", path: "/struct/banned", status: http.StatusForbidden},
+		{name: "pointer", path: "/pointer/queen", body: `{"title":"Bohemian"}`, status: http.StatusOK, want: `{"Band":"queen","Lyric":false,"title":"Bohemian"}`},
+		{name: "pointer without body", path: "/pointer/queen", status: http.StatusOK, want: `{"Band":"queen"`},
+		{name: "pointer validation", path: "/pointer/nobody", status: http.StatusBadRequest, want: "unknown band"},
+		{name: "slice", path: "/slice", body: `[1,2,3]`, status: http.StatusOK, want: "3"},
+		{name: "map", path: "/map?a=9", body: `{"a":4}`, status: http.StatusOK, want: "4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			rtr.ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if !strings.Contains(w.Body.String(), tt.want) {
+				t.Errorf("body %q does not contain %q", w.Body, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,449 @@
+package way
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Errors returned by VerifyJWT.
+var (
+	ErrTokenMalformed   = errors.New("way: malformed token")
+	ErrTokenAlgorithm   = errors.New("way: token algorithm not allowed")
+	ErrTokenKey         = errors.New("way: unknown token signing key")
+	ErrTokenSignature   = errors.New("way: invalid token signature")
+	ErrTokenExpired     = errors.New("way: token is expired")
+	ErrTokenNotYetValid = errors.New("way: token is not valid yet")
+	ErrTokenIssuer      = errors.New("way: invalid token issuer")
+	ErrTokenAudience    = errors.New("way: invalid token audience")
+)
+
+// tokenErrors are the errors describing why a token was rejected.
+var tokenErrors = []error{
+	ErrTokenMalformed, ErrTokenAlgorithm, ErrTokenKey, ErrTokenSignature,
+	ErrTokenExpired, ErrTokenNotYetValid, ErrTokenIssuer, ErrTokenAudience,
+}
+
+// ErrKeysUnavailable is wrapped by the errors of a KeySet that could
+// not get its keys, e.g. because the JWKS endpoint is down. BearerAuth
+// responds to it with 503 Service Unavailable.
+var ErrKeysUnavailable = errors.New("way: signing keys are unavailable")
+
+// errKeyType is returned for keys of a type VerifyJWT cannot use.
+var errKeyType = errors.New("way: unsupported key type")
+
+// jwtAlgorithms are the signing algorithms VerifyJWT supports.
+var jwtAlgorithms = []string{"HS256", "RS256", "ES256", "EdDSA"}
+
+// KeySet provides the keys to verify JWT signatures.
+//
+// Keys are []byte for HS256, *rsa.PublicKey for RS256,
+// *ecdsa.PublicKey for ES256 and ed25519.PublicKey for EdDSA.
+type KeySet interface {
+	// Key returns the key with the ID kid, which is empty
+	// if the token does not name one.
+	Key(ctx context.Context, kid string) (any, error)
+}
+
+// StaticKeys is a KeySet of fixed keys by key ID. A token without a
+// key ID is verified with the only key of the set, if there is one.
+type StaticKeys map[string]any
+
+// Key implements KeySet.
+func (ks StaticKeys) Key(_ context.Context, kid string) (any, error) {
+	if k, ok := ks[kid]; ok {
+		return k, nil
+	}
+	if kid == "" && len(ks) == 1 {
+		for _, k := range ks {
+			return k, nil
+		}
+	}
+	return nil, ErrTokenKey
+}
+
+// JWKS is a KeySet fetching a JSON Web Key Set (RFC 7517) from a URL.
+//
+// Keys are cached for the max-age of the response, or RefreshInterval
+// if it has none. A token signed with an unknown key causes a refetch,
+// at most once every MinRefreshInterval, so rotated keys are picked up.
+// If a refetch fails, the cached keys stay in use.
+type JWKS struct {
+	// URL of the key set, e.g. "https://example.com/.well-known/jwks.json".
+	URL string
+	// Client makes the requests. By default http.DefaultClient.
+	Client *http.Client
+	// RefreshInterval is by default 1 hour.
+	RefreshInterval time.Duration
+	// MinRefreshInterval is by default 1 minute.
+	MinRefreshInterval time.Duration
+
+	mu      sync.Mutex
+	keys    map[string]any
+	fetched time.Time
+	expires time.Time
+}
+
+// NewJWKS makes a JWKS fetching keys from url.
+func NewJWKS(url string) *JWKS {
+	return &JWKS{URL: url}
+}
+
+// Key implements KeySet.
+func (ks *JWKS) Key(ctx context.Context, kid string) (any, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	now := time.Now()
+	minRefresh := ks.MinRefreshInterval
+	if minRefresh <= 0 {
+		minRefresh = time.Minute
+	}
+	k, ok := ks.lookup(kid)
+	if ok && now.Before(ks.expires) {
+		return k, nil
+	}
+	if ks.fetched.IsZero() || now.Sub(ks.fetched) >= minRefresh {
+		// hold the lock, so concurrent requests wait for one fetch
+		if err := ks.refresh(ctx, now); err != nil && ks.keys == nil {
+			return nil, err
+		}
+		k, ok = ks.lookup(kid)
+	}
+	if !ok {
+		return nil, ErrTokenKey
+	}
+	return k, nil
+}
+
+func (ks *JWKS) lookup(kid string) (any, bool) {
+	if k, ok := ks.keys[kid]; ok {
+		return k, true
+	}
+	if kid == "" && len(ks.keys) == 1 {
+		for _, k := range ks.keys {
+			return k, true
+		}
+	}
+	return nil, false
+}
+
+// refresh fetches the key set. Must be called with ks.mu held.
+func (ks *JWKS) refresh(ctx context.Context, now time.Time) error {
+	ks.fetched = now
+	client := ks.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ks.URL, nil)
+	if err != nil {
+		return fmt.Errorf("%w: fetching JWKS: %w", ErrKeysUnavailable, err)
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: fetching JWKS: %w", ErrKeysUnavailable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: fetching JWKS: %s", ErrKeysUnavailable, resp.Status)
+	}
+	var set struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("%w: decoding JWKS: %w", ErrKeysUnavailable, err)
+	}
+	keys := make(map[string]any, len(set.Keys))
+	for _, raw := range set.Keys {
+		// skip keys of unsupported types, as RFC 7517 requires
+		if kid, k, err := ParseJWK(raw); err == nil {
+			keys[kid] = k
+		}
+	}
+	ks.keys = keys
+
+	ttl := ks.RefreshInterval
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
+	for _, d := range strings.Split(resp.Header.Get("Cache-Control"), ",") {
+		if v, ok := strings.CutPrefix(strings.TrimSpace(d), "max-age="); ok {
+			if s, err := strconv.Atoi(v); err == nil {
+				ttl = time.Duration(s) * time.Second
+			}
+		}
+	}
+	ks.expires = now.Add(ttl)
+	return nil
+}
+
+// ParseJWK parses a JSON Web Key, returning its key ID and the key
+// in the form KeySet uses. Supports RSA, P-256, Ed25519 and
+// symmetric keys meant for signatures.
+func ParseJWK(data []byte) (kid string, key any, err error) {
+	var jwk struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Use string `json:"use"`
+		Crv string `json:"crv"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+		K   string `json:"k"`
+	}
+	if err := json.Unmarshal(data, &jwk); err != nil {
+		return "", nil, fmt.Errorf("way: invalid JWK: %w", err)
+	}
+	if jwk.Use != "" && jwk.Use != "sig" {
+		return "", nil, fmt.Errorf("way: JWK %q is not for signatures", jwk.Kid)
+	}
+	b64 := base64.RawURLEncoding.DecodeString
+	switch {
+	case jwk.Kty == "RSA":
+		n, err1 := b64(jwk.N)
+		e, err2 := b64(jwk.E)
+		if err := errors.Join(err1, err2); err != nil || len(e) > 4 {
+			return "", nil, fmt.Errorf("way: invalid RSA JWK %q", jwk.Kid)
+		}
+		key = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	case jwk.Kty == "EC" && jwk.Crv == "P-256":
+		x, err1 := b64(jwk.X)
+		y, err2 := b64(jwk.Y)
+		if err := errors.Join(err1, err2); err != nil || len(x) != 32 || len(y) != 32 {
+			return "", nil, fmt.Errorf("way: invalid EC JWK %q", jwk.Kid)
+		}
+		// ecdh checks the point is on the curve
+		if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return "", nil, fmt.Errorf("way: invalid EC JWK %q: %w", jwk.Kid, err)
+		}
+		key = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	case jwk.Kty == "OKP" && jwk.Crv == "Ed25519":
+		x, err := b64(jwk.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return "", nil, fmt.Errorf("way: invalid OKP JWK %q", jwk.Kid)
+		}
+		key = ed25519.PublicKey(x)
+	case jwk.Kty == "oct":
+		k, err := b64(jwk.K)
+		if err != nil || len(k) == 0 {
+			return "", nil, fmt.Errorf("way: invalid oct JWK %q", jwk.Kid)
+		}
+		key = k
+	default:
+		return "", nil, fmt.Errorf("way: unsupported JWK type %q", jwk.Kty+" "+jwk.Crv)
+	}
+	return jwk.Kid, key, nil
+}
+
+// JWTOptions configures JWT verification.
+type JWTOptions struct {
+	// Realm is sent in the WWW-Authenticate header.
+	Realm string
+	// Keys verify token signatures. Required.
+	Keys KeySet
+	// Algorithms allowed. By default HS256, RS256, ES256 and EdDSA.
+	Algorithms []string
+	// Issuer, if set, must match the "iss" claim.
+	Issuer string
+	// Audience, if set, must be in the "aud" claim.
+	Audience string
+	// Leeway tolerated in checking "exp" and "nbf", for clock skew.
+	Leeway time.Duration
+	// Principal makes the Principal of a verified token. By default
+	// its ID is the "sub" claim, its scopes come from the "scope" or
+	// "scp" claim and its roles from the "roles" claim. An error
+	// rejects the token.
+	Principal func(claims map[string]any) (*Principal, error)
+}
+
+// JWT returns a Middleware authenticating requests with JSON Web
+// Tokens (RFC 7519) as bearer tokens. See BearerAuth.
+func JWT(opts JWTOptions) Middleware {
+	if opts.Keys == nil {
+		panic("way: JWT requires a KeySet")
+	}
+	return BearerAuth(BearerAuthOptions{
+		Realm: opts.Realm,
+		Validate: func(ctx context.Context, token string) (*Principal, error) {
+			claims, err := VerifyJWT(ctx, token, opts)
+			if err != nil {
+				return nil, err
+			}
+			p := claimsPrincipal(claims)
+			if opts.Principal != nil {
+				if p, err = opts.Principal(claims); err != nil || p == nil {
+					return nil, err
+				}
+				// the hook may return a shared principal
+				cp := *p
+				p = &cp
+			}
+			p.Claims = claims
+			return p, nil
+		},
+	})
+}
+
+// JWTClaims gets the claims of the JWT that authenticated the
+// request from the specified Context.
+func JWTClaims(ctx context.Context) (map[string]any, bool) {
+	p, ok := PrincipalFrom(ctx)
+	if !ok || p.Claims == nil {
+		return nil, false
+	}
+	return p.Claims, true
+}
+
+// VerifyJWT verifies the signature and the registered claims of a
+// JWS compact serialized token, returning its claims.
+func VerifyJWT(ctx context.Context, token string, opts JWTOptions) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrTokenMalformed
+	}
+	var header struct {
+		Alg  string   `json:"alg"`
+		Kid  string   `json:"kid"`
+		Crit []string `json:"crit"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	if len(header.Crit) > 0 {
+		// no extensions are understood
+		return nil, ErrTokenMalformed
+	}
+	allowed := opts.Algorithms
+	if allowed == nil {
+		allowed = jwtAlgorithms
+	}
+	if !slices.Contains(allowed, header.Alg) || !slices.Contains(jwtAlgorithms, header.Alg) {
+		return nil, ErrTokenAlgorithm
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrTokenMalformed
+	}
+	key, err := opts.Keys.Key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if exp, ok := claims["exp"].(float64); ok && !now.Before(unixTime(exp).Add(opts.Leeway)) {
+		return nil, ErrTokenExpired
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(opts.Leeway).Before(unixTime(nbf)) {
+		return nil, ErrTokenNotYetValid
+	}
+	if opts.Issuer != "" && claims["iss"] != opts.Issuer {
+		return nil, ErrTokenIssuer
+	}
+	if opts.Audience != "" && !slices.Contains(stringList(claims["aud"]), opts.Audience) {
+		return nil, ErrTokenAudience
+	}
+	return claims, nil
+}
+
+// verifySignature checks sig over input with key, which must be of
+// the type alg requires.
+func verifySignature(alg string, key any, input string, sig []byte) error {
+	sum := sha256.Sum256([]byte(input))
+	ok := false
+	switch k := key.(type) {
+	case []byte:
+		if alg == "HS256" {
+			mac := hmac.New(sha256.New, k)
+			mac.Write([]byte(input))
+			ok = hmac.Equal(sig, mac.Sum(nil))
+		}
+	case *rsa.PublicKey:
+		if alg == "RS256" {
+			ok = rsa.VerifyPKCS1v15(k, crypto.SHA256, sum[:], sig) == nil
+		}
+	case *ecdsa.PublicKey:
+		if alg == "ES256" && k.Curve == elliptic.P256() && len(sig) == 64 {
+			r := new(big.Int).SetBytes(sig[:32])
+			s := new(big.Int).SetBytes(sig[32:])
+			ok = ecdsa.Verify(k, sum[:], r, s)
+		}
+	case ed25519.PublicKey:
+		if alg == "EdDSA" {
+			ok = ed25519.Verify(k, []byte(input), sig)
+		}
+	default:
+		return fmt.Errorf("%w %T", errKeyType, key)
+	}
+	if !ok {
+		return ErrTokenSignature
+	}
+	return nil
+}
+
+func decodeSegment(seg string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil || json.Unmarshal(b, v) != nil {
+		return ErrTokenMalformed
+	}
+	return nil
+}
+
+func unixTime(sec float64) time.Time {
+	return time.Unix(int64(sec), 0)
+}
+
+// claimsPrincipal is the default Principal of JWTOptions.
+func claimsPrincipal(claims map[string]any) *Principal {
+	p := &Principal{Roles: stringList(claims["roles"])}
+	p.ID, _ = claims["sub"].(string)
+	if scope, ok := claims["scope"].(string); ok {
+		p.Scopes = strings.Fields(scope)
+	} else if scp, ok := claims["scp"].(string); ok {
+		p.Scopes = strings.Fields(scp)
+	} else {
+		p.Scopes = stringList(claims["scp"])
+	}
+	return p
+}
+
+// stringList reads a claim that is either a string or an array of strings.
+func stringList(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		list := make([]string, 0, len(v))
+		for _, s := range v {
+			if s, ok := s.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
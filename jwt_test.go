@@ -0,0 +1,406 @@
+package way
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testKeys are signing keys of every supported algorithm.
+type testKeys struct {
+	hs  []byte
+	rsa *rsa.PrivateKey
+	ec  *ecdsa.PrivateKey
+	ed  ed25519.PrivateKey
+}
+
+func newTestKeys(t *testing.T) testKeys {
+	t.Helper()
+	rk, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ek, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, dk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKeys{hs: []byte("0123456789abcdef0123456789abcdef"), rsa: rk, ec: ek, ed: dk}
+}
+
+// signer returns the private key of alg.
+func (k testKeys) signer(alg string) any {
+	switch alg {
+	case "HS256":
+		return k.hs
+	case "RS256":
+		return k.rsa
+	case "ES256":
+		return k.ec
+	}
+	return k.ed
+}
+
+// jwks returns the public keys as a JSON Web Key Set, with the
+// algorithms as key IDs.
+func (k testKeys) jwks() map[string]any {
+	b64 := base64.RawURLEncoding.EncodeToString
+	return map[string]any{"keys": []map[string]any{
+		{"kty": "oct", "kid": "HS256", "k": b64(k.hs)},
+		{"kty": "RSA", "kid": "RS256", "use": "sig", "n": b64(k.rsa.N.Bytes()), "e": b64(big.NewInt(int64(k.rsa.E)).Bytes())},
+		{"kty": "EC", "kid": "ES256", "crv": "P-256", "x": b64(k.ec.X.FillBytes(make([]byte, 32))), "y": b64(k.ec.Y.FillBytes(make([]byte, 32)))},
+		{"kty": "OKP", "kid": "EdDSA", "crv": "Ed25519", "x": b64(k.ed.Public().(ed25519.PublicKey))},
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": b64(k.rsa.N.Bytes()), "e": "AQAB"},
+	}}
+}
+
+// signJWT makes a token of claims signed with key.
+func signJWT(t *testing.T, alg, kid string, key any, claims map[string]any) string {
+	t.Helper()
+	b64 := base64.RawURLEncoding.EncodeToString
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	input := b64(header) + "." + b64(payload)
+	sum := sha256.Sum256([]byte(input))
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(input))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, sum[:]); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, sum[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(k, []byte(input))
+	}
+	return input + "." + b64(sig)
+}
+
+// jwksServer serves a key set, counting the fetches.
+type jwksServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	set     map[string]any
+	fetches int
+}
+
+func newJWKSServer(t *testing.T, set map[string]any) *jwksServer {
+	s := &jwksServer{set: set}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.fetches++
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.set)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *jwksServer) rotate(set map[string]any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.set = set
+}
+
+func (s *jwksServer) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fetches
+}
+
+// serveJWT serves a request with token through a route protected by mw,
+// returning the response and the ID of the principal.
+func serveJWT(mw Middleware, token string) (*httptest.ResponseRecorder, string) {
+	var id string
+	rtr := NewRouter()
+	rtr.GET("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, _ := PrincipalFrom(r.Context())
+		id = p.ID
+	}), With(mw))
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	rtr.ServeHTTP(w, r)
+	return w, id
+}
+
+func TestJWT(t *testing.T) {
+	keys := newTestKeys(t)
+	other := newTestKeys(t)
+	srv := newJWKSServer(t, keys.jwks())
+	mw := JWT(JWTOptions{
+		Keys:     NewJWKS(srv.URL),
+		Issuer:   "https://issuer.example/",
+		Audience: "api",
+		Leeway:   30 * time.Second,
+	})
+	now := time.Now().Unix()
+	valid := func(extra map[string]any) map[string]any {
+		c := map[string]any{"sub": "alice", "iss": "https://issuer.example/", "aud": "api", "exp": now + 60}
+		for k, v := range extra {
+			if v == nil {
+				delete(c, k)
+			} else {
+				c[k] = v
+			}
+		}
+		return c
+	}
+
+	tests := []struct {
+		name   string
+		alg    string
+		kid    string
+		key    any
+		claims map[string]any
+		status int
+		desc   string
+	}{
+		{name: "HS256", alg: "HS256", claims: valid(nil), status: http.StatusOK},
+		{name: "RS256", alg: "RS256", claims: valid(nil), status: http.StatusOK},
+		{name: "ES256", alg: "ES256", claims: valid(nil), status: http.StatusOK},
+		{name: "EdDSA", alg: "EdDSA", claims: valid(nil), status: http.StatusOK},
+		{name: "audience list", alg: "ES256", claims: valid(map[string]any{"aud": []string{"web", "api"}}), status: http.StatusOK},
+		{name: "no exp", alg: "EdDSA", claims: valid(map[string]any{"exp": nil}), status: http.StatusOK},
+		{name: "expired within leeway", alg: "RS256", claims: valid(map[string]any{"exp": now - 10}), status: http.StatusOK},
+		{name: "expired", alg: "RS256", claims: valid(map[string]any{"exp": now - 60}), status: http.StatusUnauthorized, desc: "token is expired"},
+		{name: "not yet valid", alg: "HS256", claims: valid(map[string]any{"nbf": now + 60}), status: http.StatusUnauthorized, desc: "token is not valid yet"},
+		{name: "valid within leeway", alg: "HS256", claims: valid(map[string]any{"nbf": now + 10}), status: http.StatusOK},
+		{name: "wrong issuer", alg: "ES256", claims: valid(map[string]any{"iss": "https://evil.example/"}), status: http.StatusUnauthorized, desc: "invalid token issuer"},
+		{name: "no issuer", alg: "ES256", claims: valid(map[string]any{"iss": nil}), status: http.StatusUnauthorized, desc: "invalid token issuer"},
+		{name: "wrong audience", alg: "EdDSA", claims: valid(map[string]any{"aud": "web"}), status: http.StatusUnauthorized, desc: "invalid token audience"},
+		{name: "no audience", alg: "EdDSA", claims: valid(map[string]any{"aud": nil}), status: http.StatusUnauthorized, desc: "invalid token audience"},
+		{name: "forged signature", alg: "RS256", key: other.rsa, claims: valid(nil), status: http.StatusUnauthorized, desc: "invalid token signature"},
+		{name: "algorithm of another key", alg: "HS256", kid: "ES256", claims: valid(nil), status: http.StatusUnauthorized, desc: "invalid token signature"},
+		{name: "unknown key", alg: "ES256", kid: "nope", claims: valid(nil), status: http.StatusUnauthorized, desc: "unknown token signing key"},
+		{name: "encryption key", alg: "RS256", kid: "enc", claims: valid(nil), status: http.StatusUnauthorized, desc: "unknown token signing key"},
+		{name: "algorithm none", alg: "none", claims: valid(nil), status: http.StatusUnauthorized, desc: "token algorithm not allowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kid, key := tt.kid, tt.key
+			if kid == "" {
+				kid = tt.alg
+			}
+			if key == nil {
+				key = keys.signer(tt.alg)
+			}
+			w, id := serveJWT(mw, signJWT(t, tt.alg, kid, key, tt.claims))
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.status == http.StatusOK && id != "alice" {
+				t.Errorf("principal = %q, want alice", id)
+			}
+			if tt.desc != "" {
+				want := `Bearer realm="", error="invalid_token", error_description="` + tt.desc + `"`
+				if got := w.Header().Get("WWW-Authenticate"); got != want {
+					t.Errorf("WWW-Authenticate = %s, want %s", got, want)
+				}
+			}
+		})
+	}
+
+	t.Run("malformed", func(t *testing.T) {
+		for _, token := range []string{"abc", "a.b.c", "a.b", "eyJhbGciOiJIUzI1NiJ9.e30.!!"} {
+			if w, _ := serveJWT(mw, token); w.Code != http.StatusUnauthorized {
+				t.Errorf("%s: status = %d, want 401", token, w.Code)
+			}
+		}
+	})
+}
+
+func TestJWTAlgorithms(t *testing.T) {
+	keys := newTestKeys(t)
+	mw := JWT(JWTOptions{
+		Keys:       StaticKeys{"HS256": keys.hs, "EdDSA": keys.ed.Public()},
+		Algorithms: []string{"EdDSA"},
+	})
+	claims := map[string]any{"sub": "alice"}
+	if w, _ := serveJWT(mw, signJWT(t, "EdDSA", "EdDSA", keys.ed, claims)); w.Code != http.StatusOK {
+		t.Errorf("EdDSA: status = %d, want 200", w.Code)
+	}
+	if w, _ := serveJWT(mw, signJWT(t, "HS256", "HS256", keys.hs, claims)); w.Code != http.StatusUnauthorized {
+		t.Errorf("HS256: status = %d, want 401", w.Code)
+	}
+}
+
+func TestJWTPrincipal(t *testing.T) {
+	keys := newTestKeys(t)
+	shared := &Principal{ID: "service"}
+	mw := JWT(JWTOptions{
+		Keys: StaticKeys{"": keys.hs},
+		Principal: func(claims map[string]any) (*Principal, error) {
+			if claims["sub"] == "mallory" {
+				return shared, errors.New("way: user is disabled")
+			}
+			return shared, nil
+		},
+	})
+
+	w, id := serveJWT(mw, signJWT(t, "HS256", "", keys.hs, map[string]any{"sub": "alice"}))
+	if w.Code != http.StatusOK || id != "service" {
+		t.Errorf("status = %d, principal = %q, want 200 and service", w.Code, id)
+	}
+	w, _ = serveJWT(mw, signJWT(t, "HS256", "", keys.hs, map[string]any{"sub": "mallory"}))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401", w.Code)
+	}
+	if shared.Claims != nil || shared.Scheme != "" {
+		t.Errorf("shared principal was modified: %+v", shared)
+	}
+}
+
+func TestJWTKeyErrors(t *testing.T) {
+	keys := newTestKeys(t)
+	down := newJWKSServer(t, keys.jwks())
+	down.Close()
+	claims := map[string]any{"sub": "alice"}
+
+	tests := []struct {
+		name   string
+		keys   KeySet
+		status int
+	}{
+		{name: "JWKS down", keys: NewJWKS(down.URL), status: http.StatusServiceUnavailable},
+		{name: "unsupported key type", keys: StaticKeys{"": "secret"}, status: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, _ := serveJWT(JWT(JWTOptions{Keys: tt.keys}), signJWT(t, "HS256", "", keys.hs, claims))
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if got := w.Header().Get("WWW-Authenticate"); got != "" {
+				t.Errorf("WWW-Authenticate = %s, want none", got)
+			}
+			if body := w.Body.String(); strings.Contains(body, "JWKS") || strings.Contains(body, "string") {
+				t.Errorf("body leaks details: %s", body)
+			}
+		})
+	}
+}
+
+func TestJWKSRotation(t *testing.T) {
+	oldKeys, newKeys := newTestKeys(t), newTestKeys(t)
+	claims := map[string]any{"sub": "alice"}
+	rotated := func(kid string) map[string]any {
+		set := newKeys.jwks()
+		set["keys"].([]map[string]any)[2]["kid"] = kid
+		return set
+	}
+
+	t.Run("refetch", func(t *testing.T) {
+		srv := newJWKSServer(t, oldKeys.jwks())
+		mw := JWT(JWTOptions{Keys: &JWKS{URL: srv.URL, MinRefreshInterval: time.Nanosecond}})
+		if w, _ := serveJWT(mw, signJWT(t, "ES256", "ES256", oldKeys.ec, claims)); w.Code != http.StatusOK {
+			t.Fatalf("old key: status = %d, want 200", w.Code)
+		}
+		srv.rotate(rotated("ES256-2"))
+		if w, _ := serveJWT(mw, signJWT(t, "ES256", "ES256-2", newKeys.ec, claims)); w.Code != http.StatusOK {
+			t.Fatalf("new key: status = %d, want 200", w.Code)
+		}
+		if n := srv.count(); n != 2 {
+			t.Errorf("fetches = %d, want 2", n)
+		}
+		// the old key is gone from the new set
+		if w, _ := serveJWT(mw, signJWT(t, "ES256", "ES256", oldKeys.ec, claims)); w.Code != http.StatusUnauthorized {
+			t.Errorf("old key after rotation: status = %d, want 401", w.Code)
+		}
+	})
+
+	t.Run("rate limited", func(t *testing.T) {
+		srv := newJWKSServer(t, oldKeys.jwks())
+		mw := JWT(JWTOptions{Keys: &JWKS{URL: srv.URL, MinRefreshInterval: time.Hour}})
+		if w, _ := serveJWT(mw, signJWT(t, "ES256", "ES256", oldKeys.ec, claims)); w.Code != http.StatusOK {
+			t.Fatalf("old key: status = %d, want 200", w.Code)
+		}
+		srv.rotate(rotated("ES256-2"))
+		for range 3 {
+			if w, _ := serveJWT(mw, signJWT(t, "ES256", "ES256-2", newKeys.ec, claims)); w.Code != http.StatusUnauthorized {
+				t.Errorf("new key: status = %d, want 401", w.Code)
+			}
+		}
+		if n := srv.count(); n != 1 {
+			t.Errorf("fetches = %d, want 1", n)
+		}
+	})
+
+	t.Run("cache expiry", func(t *testing.T) {
+		srv := newJWKSServer(t, oldKeys.jwks())
+		ks := &JWKS{URL: srv.URL, RefreshInterval: time.Nanosecond, MinRefreshInterval: time.Nanosecond}
+		for range 2 {
+			if _, err := ks.Key(context.Background(), "EdDSA"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if n := srv.count(); n != 2 {
+			t.Errorf("fetches = %d, want 2", n)
+		}
+	})
+}
+
+func TestParseJWK(t *testing.T) {
+	keys := newTestKeys(t)
+	set := keys.jwks()["keys"].([]map[string]any)
+	offCurve := map[string]any{"kty": "EC", "crv": "P-256", "x": set[2]["x"], "y": base64.RawURLEncoding.EncodeToString(make([]byte, 32))}
+
+	tests := []struct {
+		name string
+		jwk  map[string]any
+		ok   bool
+	}{
+		{name: "oct", jwk: set[0], ok: true},
+		{name: "RSA", jwk: set[1], ok: true},
+		{name: "EC", jwk: set[2], ok: true},
+		{name: "OKP", jwk: set[3], ok: true},
+		{name: "encryption", jwk: set[4]},
+		{name: "EC off curve", jwk: offCurve},
+		{name: "EC short", jwk: map[string]any{"kty": "EC", "crv": "P-256", "x": "AQ", "y": "AQ"}},
+		{name: "P-384", jwk: map[string]any{"kty": "EC", "crv": "P-384"}},
+		{name: "empty oct", jwk: map[string]any{"kty": "oct", "k": ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, _ := json.Marshal(tt.jwk)
+			kid, key, err := ParseJWK(data)
+			if (err == nil) != tt.ok {
+				t.Fatalf("err = %v, want ok %v", err, tt.ok)
+			}
+			if tt.ok && (key == nil || kid != tt.jwk["kid"]) {
+				t.Errorf("kid = %q, key = %T", kid, key)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package way
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// MaxBodySize limits the size of request bodies of a route to n
+// bytes, overriding Router.MaxBodySize. A negative n removes the limit.
+func MaxBodySize(n int64) RouteOption {
+	return func(rt *route) {
+		rt.maxBodySize = n
+	}
+}
+
+// limitBody caps the body of a request for the matched route.
+// Returns a 413 Problem if its declared length is over the limit.
+func (rtr *Router) limitBody(w http.ResponseWriter, r *http.Request) *Problem {
+	rt := routeFromContext(r.Context())
+	if rt == nil || r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+	limit := rtr.MaxBodySize
+	if rt.maxBodySize != 0 {
+		limit = rt.maxBodySize
+	}
+	if limit <= 0 {
+		return nil
+	}
+	if r.ContentLength > limit {
+		return bodyTooLarge(limit)
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+	return nil
+}
+
+func bodyTooLarge(limit int64) *Problem {
+	p := NewProblem(http.StatusRequestEntityTooLarge, fmt.Sprintf("The request body must not exceed %d bytes.", limit))
+	p.Extensions = map[string]any{"max_body_size": limit}
+	return p
+}
+
+// bodyError converts an error reading a request body to a Problem:
+// 413 if the body was over its limit, 400 otherwise.
+func bodyError(err error) *Problem {
+	var mbe *http.MaxBytesError
+	if errors.As(err, &mbe) {
+		return bodyTooLarge(mbe.Limit)
+	}
+	return NewProblem(http.StatusBadRequest, "reading request body: "+err.Error())
+}
@@ -0,0 +1,86 @@
+package way
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestMaxBodySize(t *testing.T) {
+	readAll := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			RenderError(w, r, bodyError(err))
+			return
+		}
+		io.WriteString(w, strconv.Itoa(len(b)))
+	})
+	rtr := NewRouter()
+	rtr.ErrorHandler = WriteProblem
+	rtr.MaxBodySize = 16
+	rtr.POST("/json", JSON(func(ctx context.Context, req map[string]string) (int, error) { return len(req), nil }))
+	rtr.POST("/upload", readAll)
+	rtr.POST("/large", readAll, MaxBodySize(64))
+	rtr.POST("/small", readAll, MaxBodySize(4))
+	rtr.POST("/unlimited", readAll, MaxBodySize(-1))
+
+	unlimited := NewRouter()
+	unlimited.POST("/upload", readAll)
+
+	tests := []struct {
+		name    string
+		rtr     *Router
+		path    string
+		body    string
+		chunked bool
+		status  int
+		// limit is the max_body_size of 413 responses
+		limit float64
+		want  string
+	}{
+		{name: "under router limit", rtr: rtr, path: "/upload", body: strings.Repeat("a", 16), status: http.StatusOK, want: "16"},
+		{name: "declared over router limit", rtr: rtr, path: "/upload", body: strings.Repeat("a", 17), status: http.StatusRequestEntityTooLarge, limit: 16},
+		{name: "chunked over router limit", rtr: rtr, path: "/upload", body: strings.Repeat("a", 17), chunked: true, status: http.StatusRequestEntityTooLarge, limit: 16},
+		{name: "JSON", rtr: rtr, path: "/json", body: `{"a":"b"}`, status: http.StatusOK, want: "1\n"},
+		{name: "declared JSON over limit", rtr: rtr, path: "/json", body: `{"title":"Bohemian Rhapsody"}`, status: http.StatusRequestEntityTooLarge, limit: 16},
+		{name: "chunked JSON over limit", rtr: rtr, path: "/json", body: `{"title":"Bohemian Rhapsody"}`, chunked: true, status: http.StatusRequestEntityTooLarge, limit: 16},
+		{name: "route raises limit", rtr: rtr, path: "/large", body: strings.Repeat("a", 64), status: http.StatusOK, want: "64"},
+		{name: "over raised limit", rtr: rtr, path: "/large", body: strings.Repeat("a", 65), chunked: true, status: http.StatusRequestEntityTooLarge, limit: 64},
+		{name: "route lowers limit", rtr: rtr, path: "/small", body: "abcde", status: http.StatusRequestEntityTooLarge, limit: 4},
+		{name: "route removes limit", rtr: rtr, path: "/unlimited", body: strings.Repeat("a", 1000), status: http.StatusOK, want: "1000"},
+		{name: "chunked without limit", rtr: rtr, path: "/unlimited", body: strings.Repeat("a", 1000), chunked: true, status: http.StatusOK, want: "1000"},
+		{name: "no router limit", rtr: unlimited, path: "/upload", body: strings.Repeat("a", 1000), chunked: true, status: http.StatusOK, want: "1000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			if tt.chunked {
+				r.ContentLength = -1
+				r.TransferEncoding = []string{"chunked"}
+			}
+			tt.rtr.ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.status == http.StatusOK {
+				if got := w.Body.String(); got != tt.want {
+					t.Errorf("body = %q, want %q", got, tt.want)
+				}
+				return
+			}
+			var p map[string]any
+			if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+				t.Fatal(err)
+			}
+			if p["max_body_size"] != tt.limit {
+				t.Errorf("max_body_size = %v, want %v", p["max_body_size"], tt.limit)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package way
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Logger returns a Middleware logging every request to l, or to
+// slog.Default() if l is nil. Requests are labelled with the matched
+// route pattern rather than the raw path, keeping the number of
+// distinct values small. Server errors are logged at error level.
+func Logger(l *slog.Logger) Middleware {
+	if l == nil {
+		l = slog.Default()
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			ww, sw := WrapWriter(w)
+			next.ServeHTTP(ww, r)
+
+			attrs := []slog.Attr{slog.String("method", r.Method)}
+			if rt := routeFromContext(r.Context()); rt != nil {
+				attrs = append(attrs, slog.String("route", rt.pattern))
+				if rt.name != "" {
+					attrs = append(attrs, slog.String("route_name", rt.name))
+				}
+				if len(rt.params) > 0 {
+					params := make([]any, 0, len(rt.params))
+					for _, name := range rt.params {
+						params = append(params, slog.String(name, Param(r.Context(), name)))
+					}
+					attrs = append(attrs, slog.Group("params", params...))
+				}
+			}
+			status := sw.Status()
+			attrs = append(attrs,
+				slog.Int("status", status),
+				slog.Int64("bytes", sw.BytesWritten()),
+				slog.Duration("duration", time.Since(start)),
+			)
+			id := RequestIDFrom(r.Context())
+			if id == "" {
+				// RequestID may run after Logger, and echo the ID
+				id = ww.Header().Get("X-Request-ID")
+			}
+			if id == "" {
+				id = r.Header.Get("X-Request-ID")
+			}
+			if id != "" {
+				attrs = append(attrs, slog.String("request_id", id))
+			}
+			if c, ok := ClientInfoFrom(r.Context()); ok {
+				attrs = append(attrs, slog.String("client_ip", c.IP.String()))
+			}
+
+			level := slog.LevelInfo
+			if status >= http.StatusInternalServerError {
+				level = slog.LevelError
+			}
+			l.LogAttrs(r.Context(), level, "request", attrs...)
+		})
+	}
+}
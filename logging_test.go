@@ -0,0 +1,97 @@
+package way
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	rtr := NewRouter()
+	rtr.Use(RealIP(RealIPOptions{}), Logger(slog.New(slog.NewJSONHandler(&buf, nil))))
+	rtr.GET("/music/:band/:song", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "Bohemian Rhapsody")
+	}), Name("song"))
+	rtr.GET("/broken", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-ID", "from-response")
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+
+	tests := []struct {
+		name    string
+		path    string
+		headers map[string]string
+		// want are the logged attributes besides time, msg and duration
+		want map[string]any
+	}{
+		{
+			name: "matched route",
+			path: "/music/queen/bohemian",
+			want: map[string]any{
+				"level": "INFO", "method": "GET", "route": "/music/:band/:song", "route_name": "song",
+				"params": map[string]any{"band": "queen", "song": "bohemian"},
+				"status": 200.0, "bytes": 17.0, "client_ip": "192.0.2.1",
+			},
+		},
+		{
+			name:    "request ID header",
+			path:    "/music/queen/bohemian",
+			headers: map[string]string{"X-Request-ID": "abc"},
+			want: map[string]any{
+				"level": "INFO", "method": "GET", "route": "/music/:band/:song", "route_name": "song",
+				"params": map[string]any{"band": "queen", "song": "bohemian"},
+				"status": 200.0, "bytes": 17.0, "client_ip": "192.0.2.1", "request_id": "abc",
+			},
+		},
+		{
+			name: "server error",
+			path: "/broken",
+			want: map[string]any{
+				"level": "ERROR", "method": "GET", "route": "/broken",
+				"status": 502.0, "bytes": 0.0, "client_ip": "192.0.2.1", "request_id": "from-response",
+			},
+		},
+		{
+			name: "not found",
+			path: "/nowhere",
+			want: map[string]any{
+				"level": "INFO", "method": "GET",
+				"status": 404.0, "bytes": 19.0, "client_ip": "192.0.2.1",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			rtr.ServeHTTP(httptest.NewRecorder(), r)
+
+			var got map[string]any
+			if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+				t.Fatalf("decoding %q: %v", buf.String(), err)
+			}
+			if got["msg"] != "request" {
+				t.Errorf("msg = %v, want request", got["msg"])
+			}
+			if _, ok := got["duration"].(float64); !ok {
+				t.Errorf("duration = %v, want a number", got["duration"])
+			}
+			delete(got, "time")
+			delete(got, "msg")
+			delete(got, "duration")
+			gotJSON, _ := json.Marshal(got)
+			wantJSON, _ := json.Marshal(tt.want)
+			if !bytes.Equal(gotJSON, wantJSON) {
+				t.Errorf("attributes = %s, want %s", gotJSON, wantJSON)
+			}
+		})
+	}
+}
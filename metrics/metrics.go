@@ -0,0 +1,219 @@
+// Package metrics records HTTP metrics for a way.Router labelled by
+// method, route pattern and status class, and exposes them in the
+// Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/peppe998e/way"
+)
+
+// DefaultBuckets are the default latency histogram buckets, in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// unmatched is the route label of requests no route matched.
+const unmatched = "unmatched"
+
+// Options configures Metrics.
+type Options struct {
+	// Namespace is prepended to every metric name, e.g. "myapp"
+	// gives "myapp_http_requests_total".
+	Namespace string
+	// Buckets are the upper bounds of the latency histogram,
+	// in seconds. By default uses DefaultBuckets.
+	Buckets []float64
+}
+
+// Metrics collects request counts, latency histograms and in-flight
+// gauges. Its Middleware is added with Router.Use and the Metrics
+// itself is an http.Handler serving the collected values:
+//
+//	m := metrics.New(metrics.Options{})
+//	router.Use(m.Middleware)
+//	router.GET("/metrics", m)
+type Metrics struct {
+	prefix  string
+	buckets []float64
+
+	mu       sync.Mutex
+	requests map[requestKey]*histogram
+	inFlight map[routeKey]int64
+}
+
+type routeKey struct {
+	method string
+	route  string
+}
+
+type requestKey struct {
+	routeKey
+	status string
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// New makes a new Metrics.
+func New(opts Options) *Metrics {
+	buckets := opts.Buckets
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	prefix := ""
+	if opts.Namespace != "" {
+		prefix = opts.Namespace + "_"
+	}
+	return &Metrics{
+		prefix:   prefix,
+		buckets:  buckets,
+		requests: make(map[requestKey]*histogram),
+		inFlight: make(map[routeKey]int64),
+	}
+}
+
+// Middleware records metrics for every request passing through it.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rk := routeKey{method: method(r.Method), route: way.RoutePattern(r.Context())}
+		if rk.route == "" {
+			rk.route = unmatched
+		}
+
+		m.mu.Lock()
+		m.inFlight[rk]++
+		m.mu.Unlock()
+
+		start := time.Now()
+		ww, sw := way.WrapWriter(w)
+		defer func() {
+			elapsed := time.Since(start).Seconds()
+			key := requestKey{routeKey: rk, status: strconv.Itoa(sw.Status()/100) + "xx"}
+
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			m.inFlight[rk]--
+			h, ok := m.requests[key]
+			if !ok {
+				h = &histogram{counts: make([]uint64, len(m.buckets))}
+				m.requests[key] = h
+			}
+			for i, le := range m.buckets {
+				if elapsed <= le {
+					h.counts[i]++
+					break
+				}
+			}
+			h.count++
+			h.sum += elapsed
+		}()
+		next.ServeHTTP(ww, r)
+	})
+}
+
+// ServeHTTP writes the collected metrics in the Prometheus
+// text exposition format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	bw := bufio.NewWriter(w)
+	m.writeTo(bw)
+	bw.Flush()
+}
+
+func (m *Metrics) writeTo(w *bufio.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]requestKey, 0, len(m.requests))
+	for k := range m.requests {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.status < b.status
+	})
+
+	name := m.prefix + "http_requests_total"
+	fmt.Fprintf(w, "# HELP %s Total number of HTTP requests.\n# TYPE %s counter\n", name, name)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s{%s} %d\n", name, k.labels(), m.requests[k].count)
+	}
+
+	name = m.prefix + "http_request_duration_seconds"
+	fmt.Fprintf(w, "# HELP %s HTTP request latency in seconds.\n# TYPE %s histogram\n", name, name)
+	for _, k := range keys {
+		h, labels := m.requests[k], k.labels()
+		var cumulative uint64
+		for i, le := range m.buckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, formatFloat(le), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, h.count)
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", name, labels, formatFloat(h.sum))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, h.count)
+	}
+
+	flight := make([]routeKey, 0, len(m.inFlight))
+	for k := range m.inFlight {
+		flight = append(flight, k)
+	}
+	sort.Slice(flight, func(i, j int) bool {
+		if flight[i].route != flight[j].route {
+			return flight[i].route < flight[j].route
+		}
+		return flight[i].method < flight[j].method
+	})
+
+	name = m.prefix + "http_requests_in_flight"
+	fmt.Fprintf(w, "# HELP %s Number of HTTP requests being served.\n# TYPE %s gauge\n", name, name)
+	for _, k := range flight {
+		fmt.Fprintf(w, "%s{%s} %d\n", name, k.labels(), m.inFlight[k])
+	}
+}
+
+func (k routeKey) labels() string {
+	return fmt.Sprintf("method=\"%s\",route=\"%s\"", escape(k.method), escape(k.route))
+}
+
+func (k requestKey) labels() string {
+	return fmt.Sprintf("%s,status=\"%s\"", k.routeKey.labels(), k.status)
+}
+
+// method normalizes the request method so that arbitrary
+// client-supplied methods cannot grow the number of series.
+func method(m string) string {
+	switch m {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return m
+	}
+	return "OTHER"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escape(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
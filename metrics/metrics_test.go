@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/peppe998e/way"
+)
+
+func TestMetrics(t *testing.T) {
+	m := New(Options{Namespace: "app", Buckets: []float64{10, 0.5}})
+	rtr := way.NewRouter()
+	rtr.Use(m.Middleware)
+	rtr.GET("/metrics", m)
+	rtr.GET("/music/:band", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	rtr.POST("/music/:band", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	rtr.GET("/fail", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+
+	for _, req := range []struct{ method, path string }{
+		{http.MethodGet, "/music/a"},
+		{http.MethodGet, "/music/b"},
+		{http.MethodPost, "/music/a"},
+		{http.MethodGet, "/fail"},
+		{http.MethodGet, "/nowhere"},
+		{"BREW", "/music/a"},
+	} {
+		rtr.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(req.method, req.path, nil))
+	}
+	w := httptest.NewRecorder()
+	rtr.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	body := w.Body.String()
+
+	tests := []struct {
+		name string
+		line string
+	}{
+		{name: "counter type", line: "# TYPE app_http_requests_total counter"},
+		{name: "requests by route", line: `app_http_requests_total{method="GET",route="/music/:band",status="2xx"} 2`},
+		{name: "requests by method", line: `app_http_requests_total{method="POST",route="/music/:band",status="2xx"} 1`},
+		{name: "server errors", line: `app_http_requests_total{method="GET",route="/fail",status="5xx"} 1`},
+		{name: "unmatched", line: `app_http_requests_total{method="GET",route="unmatched",status="4xx"} 1`},
+		{name: "other methods", line: `app_http_requests_total{method="OTHER",route="unmatched",status="4xx"} 1`},
+		{name: "histogram type", line: "# TYPE app_http_request_duration_seconds histogram"},
+		{name: "sorted buckets", line: `app_http_request_duration_seconds_bucket{method="GET",route="/music/:band",status="2xx",le="0.5"} 2`},
+		{name: "cumulative buckets", line: `app_http_request_duration_seconds_bucket{method="GET",route="/music/:band",status="2xx",le="10"} 2`},
+		{name: "infinity bucket", line: `app_http_request_duration_seconds_bucket{method="GET",route="/music/:band",status="2xx",le="+Inf"} 2`},
+		{name: "histogram count", line: `app_http_request_duration_seconds_count{method="GET",route="/music/:band",status="2xx"} 2`},
+		{name: "gauge type", line: "# TYPE app_http_requests_in_flight gauge"},
+		{name: "finished requests", line: `app_http_requests_in_flight{method="GET",route="/music/:band"} 0`},
+		{name: "serving the metrics", line: `app_http_requests_in_flight{method="GET",route="/metrics"} 1`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !strings.Contains(body, tt.line+"\n") {
+				t.Errorf("missing line %s in\n%s", tt.line, body)
+			}
+		})
+	}
+}
+
+func TestEscape(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"/plain/:id", "/plain/:id"},
+		{`a"b`, `a\"b`},
+		{`a\b`, `a\\b`},
+		{"a\nb", `a\nb`},
+	}
+	for _, tt := range tests {
+		if got := escape(tt.in); got != tt.want {
+			t.Errorf("escape(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package way
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Schema is a JSON Schema, as used by OpenAPI 3.1 documents.
+type Schema map[string]any
+
+// Parameter describes a query, header, path or cookie parameter
+// of an Operation.
+type Parameter struct {
+	Name        string
+	In          string // "query", "header", "path" or "cookie"
+	Description string
+	Required    bool
+	Schema      Schema
+}
+
+// Operation is the OpenAPI metadata of a route, set with the Doc option.
+type Operation struct {
+	// OperationID defaults to the route name.
+	OperationID string
+	Summary     string
+	Description string
+	Tags        []string
+	// Parameters declares parameters besides the path parameters,
+	// which are documented as strings unless declared here.
+	Parameters []Parameter
+	// RequestBody is the schema of the request body, if any, for
+	// the media types of the Consumes option or application/json.
+	RequestBody Schema
+	// Responses maps status codes to the schema of the response
+	// body, which may be nil for responses without one, for the
+	// media types of the Produces option or application/json.
+	Responses map[int]Schema
+	// Deprecated marks the operation as deprecated.
+	Deprecated bool
+}
+
+// Doc sets the OpenAPI metadata of a route.
+func Doc(op Operation) RouteOption {
+	return func(rt *route) {
+		rt.doc = &op
+	}
+}
+
+// OpenAPIInfo is the info object of an OpenAPI document.
+type OpenAPIInfo struct {
+	Title       string
+	Version     string
+	Description string
+}
+
+// openAPIMethods maps the method bits to OpenAPI operation names,
+// in the order operations are listed in a path item.
+var openAPIMethods = []struct {
+	bit  int
+	name string
+}{
+	{WAY_GET, "get"},
+	{WAY_PUT, "put"},
+	{WAY_POST, "post"},
+	{WAY_DELETE, "delete"},
+	{WAY_OPTIONS, "options"},
+	{WAY_HEAD, "head"},
+	{WAY_TRACE, "trace"},
+}
+
+// OpenAPI builds an OpenAPI 3.1 document describing the registered
+// routes. Path parameters such as ":id" become "{id}". Prefix routes
+// cannot be described by OpenAPI and are left out.
+func (rtr *Router) OpenAPI(info OpenAPIInfo) map[string]any {
+	infoObj := map[string]any{
+		"title":   info.Title,
+		"version": info.Version,
+	}
+	if info.Description != "" {
+		infoObj["description"] = info.Description
+	}
+
+	paths := map[string]any{}
+	for _, rt := range rtr.routes {
+		if rt.prefix {
+			continue
+		}
+		path := rt.openAPIPath()
+		item, ok := paths[path].(map[string]any)
+		if !ok {
+			item = map[string]any{}
+			paths[path] = item
+		}
+		for _, m := range openAPIMethods {
+			if !rt.hasMethods(m.bit) {
+				continue
+			}
+			// like ServeHTTP, the first route registered wins
+			if _, ok := item[m.name]; !ok {
+				item[m.name] = rt.openAPIOperation()
+			}
+		}
+	}
+
+	return map[string]any{
+		"openapi": "3.1.0",
+		"info":    infoObj,
+		"paths":   paths,
+	}
+}
+
+// OpenAPIHandler returns an http.Handler serving the OpenAPI document
+// of the router as JSON, e.g. to be mounted at /openapi.json.
+func (rtr *Router) OpenAPIHandler(info OpenAPIInfo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rtr.OpenAPI(info))
+	})
+}
+
+// openAPIPath converts the route pattern to an OpenAPI path template.
+func (rt *route) openAPIPath() string {
+	segs := make([]string, len(rt.segs))
+	for i, seg := range rt.segs {
+		if strings.HasPrefix(seg, ":") {
+			seg = "{" + strings.TrimPrefix(seg, ":") + "}"
+		}
+		segs[i] = seg
+	}
+	return "/" + strings.Join(segs, "/")
+}
+
+func (rt *route) openAPIOperation() map[string]any {
+	op := rt.doc
+	if op == nil {
+		op = &Operation{}
+	}
+	obj := map[string]any{}
+
+	if id := op.OperationID; id != "" {
+		obj["operationId"] = id
+	} else if rt.name != "" {
+		obj["operationId"] = rt.name
+	}
+	if op.Summary != "" {
+		obj["summary"] = op.Summary
+	}
+	if op.Description != "" {
+		obj["description"] = op.Description
+	}
+	if len(op.Tags) > 0 {
+		obj["tags"] = op.Tags
+	}
+	if op.Deprecated {
+		obj["deprecated"] = true
+	}
+
+	var params []any
+	declared := map[string]bool{}
+	for _, p := range op.Parameters {
+		if p.In == "path" {
+			declared[p.Name] = true
+		}
+		params = append(params, p.openAPI())
+	}
+	for _, name := range rt.params {
+		if !declared[name] {
+			params = append(params, Parameter{Name: name, In: "path", Schema: Schema{"type": "string"}}.openAPI())
+		}
+	}
+	if len(params) > 0 {
+		obj["parameters"] = params
+	}
+
+	if op.RequestBody != nil {
+		obj["requestBody"] = map[string]any{
+			"required": true,
+			"content":  openAPIContent(rt.consumes, op.RequestBody),
+		}
+	}
+
+	responses := map[string]any{}
+	for status, schema := range op.Responses {
+		resp := map[string]any{"description": http.StatusText(status)}
+		if schema != nil {
+			resp["content"] = openAPIContent(rt.produces, schema)
+		}
+		responses[strconv.Itoa(status)] = resp
+	}
+	if len(responses) == 0 {
+		responses["default"] = map[string]any{"description": "Default response"}
+	}
+	obj["responses"] = responses
+
+	return obj
+}
+
+// openAPIContent builds a content map with the same schema for each
+// of the media types, which default to application/json.
+func openAPIContent(types []string, schema Schema) map[string]any {
+	if len(types) == 0 {
+		types = []string{"application/json"}
+	}
+	content := map[string]any{}
+	for _, mt := range types {
+		content[mt] = map[string]any{"schema": schema}
+	}
+	return content
+}
+
+func (p Parameter) openAPI() map[string]any {
+	obj := map[string]any{
+		"name": p.Name,
+		"in":   p.In,
+	}
+	if p.Description != "" {
+		obj["description"] = p.Description
+	}
+	// path parameters are always required
+	if p.Required || p.In == "path" {
+		obj["required"] = true
+	}
+	if p.Schema != nil {
+		obj["schema"] = p.Schema
+	}
+	return obj
+}
@@ -0,0 +1,140 @@
+package way
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// jsonRoundTrip marshals v and decodes it back, so documents can be
+// compared with JSON literals.
+func jsonRoundTrip(t *testing.T, v any) any {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out any
+	if err := json.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestOpenAPI(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	rtr := NewRouter()
+	rtr.GET("/", h, Name("home"))
+	rtr.Handle(WAY_GET|WAY_PUT|WAY_DELETE, "/songs/:id", h, Name("song"))
+	rtr.POST("/bands/:band/songs", h,
+		Consumes("application/json", "application/xml"),
+		Produces("application/json", "text/csv"),
+		Doc(Operation{
+			OperationID: "createSong",
+			Summary:     "Create a song",
+			Description: "Adds a song to a band.",
+			Tags:        []string{"songs"},
+			Parameters: []Parameter{
+				{Name: "band", In: "path", Schema: Schema{"type": "integer"}},
+				{Name: "draft", In: "query", Description: "Keep unpublished.", Schema: Schema{"type": "boolean"}},
+			},
+			RequestBody: Schema{"type": "object"},
+			Responses:   map[int]Schema{http.StatusCreated: {"type": "object"}, http.StatusNoContent: nil},
+			Deprecated:  true,
+		}))
+	rtr.GET("/files/", h)
+	rtr.GET("/images...", h)
+	// the first route registered wins
+	rtr.GET("/songs/:id", h, Name("shadowed"))
+
+	doc := rtr.OpenAPI(OpenAPIInfo{Title: "Music", Version: "1.0", Description: "Songs and bands."})
+	paths := doc["paths"].(map[string]any)
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{
+			name: "root",
+			path: "/",
+			want: `{"get":{"operationId":"home","responses":{"default":{"description":"Default response"}}}}`,
+		},
+		{
+			name: "path parameters and methods",
+			path: "/songs/{id}",
+			want: `{
+				"get":{"operationId":"song","parameters":[{"name":"id","in":"path","required":true,"schema":{"type":"string"}}],"responses":{"default":{"description":"Default response"}}},
+				"put":{"operationId":"song","parameters":[{"name":"id","in":"path","required":true,"schema":{"type":"string"}}],"responses":{"default":{"description":"Default response"}}},
+				"delete":{"operationId":"song","parameters":[{"name":"id","in":"path","required":true,"schema":{"type":"string"}}],"responses":{"default":{"description":"Default response"}}}
+			}`,
+		},
+		{
+			name: "metadata and content",
+			path: "/bands/{band}/songs",
+			want: `{"post":{
+				"operationId":"createSong",
+				"summary":"Create a song",
+				"description":"Adds a song to a band.",
+				"tags":["songs"],
+				"deprecated":true,
+				"parameters":[
+					{"name":"band","in":"path","required":true,"schema":{"type":"integer"}},
+					{"name":"draft","in":"query","description":"Keep unpublished.","schema":{"type":"boolean"}}
+				],
+				"requestBody":{"required":true,"content":{
+					"application/json":{"schema":{"type":"object"}},
+					"application/xml":{"schema":{"type":"object"}}
+				}},
+				"responses":{
+					"201":{"description":"Created","content":{
+						"application/json":{"schema":{"type":"object"}},
+						"text/csv":{"schema":{"type":"object"}}
+					}},
+					"204":{"description":"No Content"}
+				}
+			}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var want any
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			if got := jsonRoundTrip(t, paths[tt.path]); !reflect.DeepEqual(got, want) {
+				t.Errorf("path item = %v, want %v", got, want)
+			}
+		})
+	}
+
+	if len(paths) != len(tests) {
+		t.Errorf("paths = %v, want prefix routes left out", paths)
+	}
+	info := jsonRoundTrip(t, doc["info"])
+	if want := map[string]any{"title": "Music", "version": "1.0", "description": "Songs and bands."}; !reflect.DeepEqual(info, want) {
+		t.Errorf("info = %v, want %v", info, want)
+	}
+	if doc["openapi"] != "3.1.0" {
+		t.Errorf("openapi = %v, want 3.1.0", doc["openapi"])
+	}
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+	rtr := NewRouter()
+	rtr.GET("/songs/:id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	w := httptest.NewRecorder()
+	rtr.OpenAPIHandler(OpenAPIInfo{Title: "Music"}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := doc["paths"].(map[string]any)["/songs/{id}"]; !ok {
+		t.Errorf("paths = %v", doc["paths"])
+	}
+}
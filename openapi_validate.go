@@ -0,0 +1,666 @@
+package way
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// OpenAPISpec is a loaded OpenAPI 3 document used to validate
+// requests before they reach their handlers.
+type OpenAPISpec struct {
+	doc map[string]any
+	ops map[string]map[string]*specOperation // template key -> method -> operation
+
+	patterns sync.Map // string -> *regexp.Regexp
+}
+
+type specOperation struct {
+	path         string // path template, e.g. "/songs/{songId}"
+	params       []specParam
+	body         Schema
+	bodyRequired bool
+}
+
+type specParam struct {
+	name     string
+	in       string
+	required bool
+	schema   Schema
+}
+
+// ValidationError describes a part of a request that does
+// not conform to the OpenAPI document.
+type ValidationError struct {
+	// In is where the invalid value is: "path", "query",
+	// "header", "cookie" or "body".
+	In string `json:"in"`
+	// Name is the parameter name, or the JSON pointer
+	// of the invalid value within the body.
+	Name    string `json:"name"`
+	Message string `json:"detail"`
+}
+
+// Error implements the error interface.
+func (e ValidationError) Error() string {
+	if e.Name == "" {
+		return e.In + ": " + e.Message
+	}
+	return e.In + " " + e.Name + ": " + e.Message
+}
+
+// ParseOpenAPI parses an OpenAPI 3 document in JSON or YAML format.
+// YAML documents may use block and flow collections, quoted and block
+// scalars and comments, but not anchors, aliases or tags; others can
+// be decoded into a map with a YAML library and passed to
+// NewOpenAPISpec instead.
+func ParseOpenAPI(data []byte) (*OpenAPISpec, error) {
+	var doc map[string]any
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("way: parsing OpenAPI document: %w", err)
+		}
+		return NewOpenAPISpec(doc)
+	}
+	v, err := parseYAML(data)
+	if err != nil {
+		return nil, fmt.Errorf("way: parsing OpenAPI document: %w", err)
+	}
+	doc, ok := v.(map[string]any)
+	if !ok {
+		return nil, errors.New("way: parsing OpenAPI document: not a mapping")
+	}
+	return NewOpenAPISpec(doc)
+}
+
+// NewOpenAPISpec makes an OpenAPISpec from a decoded OpenAPI 3 document.
+func NewOpenAPISpec(doc map[string]any) (*OpenAPISpec, error) {
+	version, _ := doc["openapi"].(string)
+	if !strings.HasPrefix(version, "3.") {
+		return nil, fmt.Errorf("way: unsupported OpenAPI version %q", version)
+	}
+	spec := &OpenAPISpec{doc: doc, ops: map[string]map[string]*specOperation{}}
+
+	paths, _ := doc["paths"].(map[string]any)
+	for path, v := range paths {
+		item, ok := spec.resolve(v).(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("way: invalid OpenAPI path item %q", path)
+		}
+		common := spec.params(item["parameters"])
+		methods := map[string]*specOperation{}
+		for method, v := range item {
+			switch method {
+			case "get", "put", "post", "delete", "options", "head", "patch", "trace":
+			default:
+				continue
+			}
+			opObj, ok := v.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("way: invalid OpenAPI operation %s %s", method, path)
+			}
+			op := &specOperation{path: path}
+			// operation parameters override path item ones
+			for _, p := range common {
+				if !containsParam(spec.params(opObj["parameters"]), p) {
+					op.params = append(op.params, p)
+				}
+			}
+			op.params = append(op.params, spec.params(opObj["parameters"])...)
+			if body, ok := spec.resolve(opObj["requestBody"]).(map[string]any); ok {
+				op.bodyRequired, _ = body["required"].(bool)
+				content, _ := body["content"].(map[string]any)
+				for mt, v := range content {
+					if !isJSON(mt) {
+						continue
+					}
+					if media, ok := v.(map[string]any); ok {
+						op.body, _ = media["schema"].(map[string]any)
+					}
+				}
+			}
+			methods[method] = op
+		}
+		spec.ops[templateKey(path)] = methods
+	}
+	return spec, nil
+}
+
+// templateKey blanks the parameter names of a path template, so
+// "/songs/{songId}" and the "/songs/{id}" of a route are the same.
+func templateKey(path string) string {
+	segs := strings.Split(path, "/")
+	for i, seg := range segs {
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+			segs[i] = "{}"
+		}
+	}
+	return strings.Join(segs, "/")
+}
+
+// routeParam returns the name the route gives to the path
+// parameter name of the operation, which is at the same position.
+func (op *specOperation) routeParam(rt *route, name string) string {
+	for i, seg := range strings.Split(strings.Trim(op.path, "/"), "/") {
+		if seg == "{"+name+"}" && i < len(rt.segs) {
+			return strings.TrimPrefix(rt.segs[i], ":")
+		}
+	}
+	return name
+}
+
+// params decodes a list of parameter objects.
+func (spec *OpenAPISpec) params(v any) []specParam {
+	list, _ := v.([]any)
+	var params []specParam
+	for _, v := range list {
+		obj, ok := spec.resolve(v).(map[string]any)
+		if !ok {
+			continue
+		}
+		p := specParam{}
+		p.name, _ = obj["name"].(string)
+		p.in, _ = obj["in"].(string)
+		p.required, _ = obj["required"].(bool)
+		p.schema, _ = obj["schema"].(map[string]any)
+		if p.in == "path" {
+			p.required = true
+		}
+		params = append(params, p)
+	}
+	return params
+}
+
+func containsParam(params []specParam, p specParam) bool {
+	for _, q := range params {
+		if q.name == p.name && q.in == p.in {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve follows a local "$ref" such as "#/components/schemas/Song".
+func (spec *OpenAPISpec) resolve(v any) any {
+	for i := 0; i < 32; i++ { // guard against reference cycles
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return v
+		}
+		ref, ok := obj["$ref"].(string)
+		if !ok || !strings.HasPrefix(ref, "#/") {
+			return v
+		}
+		var cur any = spec.doc
+		for _, tok := range strings.Split(ref[2:], "/") {
+			tok = strings.NewReplacer("~1", "/", "~0", "~").Replace(tok)
+			m, ok := cur.(map[string]any)
+			if !ok {
+				return nil
+			}
+			cur = m[tok]
+		}
+		v = cur
+	}
+	return v
+}
+
+// Validator returns a Middleware validating requests against the
+// operation the spec defines for the matched route pattern and
+// method. Path, query and header parameters are checked against
+// their schemas, as are JSON request bodies. Invalid requests are
+// rejected with a 400 Problem listing every ValidationError under
+// the "errors" member; requests for operations the spec does not
+// define are passed through. Path templates match route patterns
+// whatever their parameters are named.
+func (spec *OpenAPISpec) Validator() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rt := routeFromContext(r.Context())
+			if rt == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			op := spec.ops[templateKey(rt.openAPIPath())][strings.ToLower(r.Method)]
+			if op == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			errs, err := spec.validateRequest(op, rt, r)
+			if err != nil {
+				RenderError(w, r, bodyError(err))
+				return
+			}
+			if len(errs) > 0 {
+				p := NewProblem(http.StatusBadRequest, "The request does not conform to the API specification.")
+				p.Extensions = map[string]any{"errors": errs}
+				RenderError(w, r, p)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// validateRequest returns the ways r, matched to rt, does not
+// conform to op, or an error if its body cannot be read.
+func (spec *OpenAPISpec) validateRequest(op *specOperation, rt *route, r *http.Request) ([]ValidationError, error) {
+	var errs []ValidationError
+	query := r.URL.Query()
+	for _, p := range op.params {
+		var values []string
+		switch p.in {
+		case "path":
+			if v := Param(r.Context(), op.routeParam(rt, p.name)); v != "" {
+				values = []string{v}
+			}
+		case "query":
+			values = query[p.name]
+		case "header":
+			values = r.Header.Values(p.name)
+		case "cookie":
+			if c, err := r.Cookie(p.name); err == nil {
+				values = []string{c.Value}
+			}
+		}
+		if len(values) == 0 {
+			if p.required {
+				errs = append(errs, ValidationError{In: p.in, Name: p.name, Message: "is required"})
+			}
+			continue
+		}
+		schema, _ := spec.resolve(map[string]any(p.schema)).(map[string]any)
+		v, err := coerceParam(values, schema, spec)
+		if err != nil {
+			errs = append(errs, ValidationError{In: p.in, Name: p.name, Message: err.Error()})
+			continue
+		}
+		for _, err := range spec.validate(schema, v, "") {
+			errs = append(errs, ValidationError{In: p.in, Name: p.name, Message: err.Message})
+		}
+	}
+
+	if op.body == nil {
+		return errs, nil
+	}
+	data, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		if op.bodyRequired {
+			errs = append(errs, ValidationError{In: "body", Message: "is required"})
+		}
+		return errs, nil
+	}
+	if ct := r.Header.Get("Content-Type"); ct != "" && !isJSON(ct) {
+		return append(errs, ValidationError{In: "body", Message: "unsupported content type " + ct}), nil
+	}
+	var body any
+	if err := json.Unmarshal(data, &body); err != nil {
+		return append(errs, ValidationError{In: "body", Message: "invalid JSON: " + err.Error()}), nil
+	}
+	for _, err := range spec.validate(op.body, body, "") {
+		err.In = "body"
+		errs = append(errs, err)
+	}
+	return errs, nil
+}
+
+// coerceParam converts the string values of a parameter to the
+// JSON value its schema describes.
+func coerceParam(values []string, schema map[string]any, spec *OpenAPISpec) (any, error) {
+	switch schemaType(schema) {
+	case "array":
+		if len(values) == 1 {
+			values = strings.Split(values[0], ",")
+		}
+		items, _ := spec.resolve(schema["items"]).(map[string]any)
+		list := make([]any, len(values))
+		for i, v := range values {
+			item, err := coerceParam([]string{v}, items, spec)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = item
+		}
+		return list, nil
+	case "integer":
+		n, err := strconv.ParseInt(values[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("must be an integer")
+		}
+		return float64(n), nil
+	case "number":
+		f, err := strconv.ParseFloat(values[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("must be a number")
+		}
+		return f, nil
+	case "boolean":
+		b, err := strconv.ParseBool(values[0])
+		if err != nil {
+			return nil, fmt.Errorf("must be a boolean")
+		}
+		return b, nil
+	}
+	return values[0], nil
+}
+
+// schemaType returns the first non-null type of a schema.
+func schemaType(schema map[string]any) string {
+	switch t := schema["type"].(type) {
+	case string:
+		return t
+	case []any:
+		for _, v := range t {
+			if s, ok := v.(string); ok && s != "null" {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// validate checks v against a subset of JSON Schema: type, enum,
+// const, string, numeric, array and object constraints and the
+// allOf, anyOf, oneOf and not combinators. ptr is the JSON pointer
+// of v, used to name the invalid values.
+func (spec *OpenAPISpec) validate(schema map[string]any, v any, ptr string) []ValidationError {
+	schema, _ = spec.resolve(map[string]any(schema)).(map[string]any)
+	if schema == nil {
+		return nil
+	}
+	fail := func(format string, args ...any) []ValidationError {
+		return []ValidationError{{Name: ptr, Message: fmt.Sprintf(format, args...)}}
+	}
+
+	if t, ok := schema["type"]; ok {
+		var types []string
+		switch t := t.(type) {
+		case string:
+			types = []string{t}
+		case []any:
+			for _, v := range t {
+				if s, ok := v.(string); ok {
+					types = append(types, s)
+				}
+			}
+		}
+		if nullable, _ := schema["nullable"].(bool); nullable {
+			types = append(types, "null")
+		}
+		matched := false
+		for _, t := range types {
+			if hasType(v, t) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fail("must be of type %s", strings.Join(types, " or "))
+		}
+	}
+	if enum, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, e := range enum {
+			if jsonEqual(e, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fail("must be one of the allowed values")
+		}
+	}
+	if c, ok := schema["const"]; ok && !jsonEqual(c, v) {
+		return fail("must be equal to the constant value")
+	}
+
+	var errs []ValidationError
+	switch v := v.(type) {
+	case string:
+		n := float64(len([]rune(v)))
+		if min, ok := number(schema["minLength"]); ok && n < min {
+			errs = append(errs, fail("must be at least %v characters long", min)...)
+		}
+		if max, ok := number(schema["maxLength"]); ok && n > max {
+			errs = append(errs, fail("must be at most %v characters long", max)...)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			if re := spec.regexp(pattern); re != nil && !re.MatchString(v) {
+				errs = append(errs, fail("must match pattern %s", pattern)...)
+			}
+		}
+	case float64:
+		// OpenAPI 3.0 makes minimum and maximum exclusive with booleans,
+		// 3.1 gives the exclusive bounds as numbers
+		if min, ok := number(schema["minimum"]); ok {
+			if schema["exclusiveMinimum"] == true {
+				if v <= min {
+					errs = append(errs, fail("must be > %v", min)...)
+				}
+			} else if v < min {
+				errs = append(errs, fail("must be >= %v", min)...)
+			}
+		}
+		if max, ok := number(schema["maximum"]); ok {
+			if schema["exclusiveMaximum"] == true {
+				if v >= max {
+					errs = append(errs, fail("must be < %v", max)...)
+				}
+			} else if v > max {
+				errs = append(errs, fail("must be <= %v", max)...)
+			}
+		}
+		if min, ok := number(schema["exclusiveMinimum"]); ok && v <= min {
+			errs = append(errs, fail("must be > %v", min)...)
+		}
+		if max, ok := number(schema["exclusiveMaximum"]); ok && v >= max {
+			errs = append(errs, fail("must be < %v", max)...)
+		}
+		if m, ok := number(schema["multipleOf"]); ok && m > 0 {
+			if q := v / m; math.Abs(q-math.Round(q)) > 1e-9 {
+				errs = append(errs, fail("must be a multiple of %v", m)...)
+			}
+		}
+	case []any:
+		n := float64(len(v))
+		if min, ok := number(schema["minItems"]); ok && n < min {
+			errs = append(errs, fail("must have at least %v items", min)...)
+		}
+		if max, ok := number(schema["maxItems"]); ok && n > max {
+			errs = append(errs, fail("must have at most %v items", max)...)
+		}
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range v {
+				errs = append(errs, spec.validate(items, item, ptr+"/"+strconv.Itoa(i))...)
+			}
+		}
+	case map[string]any:
+		if required, ok := schema["required"].([]any); ok {
+			for _, name := range required {
+				if name, ok := name.(string); ok {
+					if _, ok := v[name]; !ok {
+						errs = append(errs, ValidationError{Name: ptr + "/" + name, Message: "is required"})
+					}
+				}
+			}
+		}
+		props, _ := schema["properties"].(map[string]any)
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if prop, ok := props[name].(map[string]any); ok {
+				errs = append(errs, spec.validate(prop, v[name], ptr+"/"+name)...)
+				continue
+			}
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					errs = append(errs, ValidationError{Name: ptr + "/" + name, Message: "is not allowed"})
+				}
+			case map[string]any:
+				errs = append(errs, spec.validate(additional, v[name], ptr+"/"+name)...)
+			}
+		}
+	}
+
+	if all, ok := schema["allOf"].([]any); ok {
+		for _, sub := range all {
+			if sub, ok := sub.(map[string]any); ok {
+				errs = append(errs, spec.validate(sub, v, ptr)...)
+			}
+		}
+	}
+	if anyOf, ok := schema["anyOf"].([]any); ok && spec.countValid(anyOf, v, ptr) == 0 {
+		errs = append(errs, fail("must match at least one schema in anyOf")...)
+	}
+	if oneOf, ok := schema["oneOf"].([]any); ok && spec.countValid(oneOf, v, ptr) != 1 {
+		errs = append(errs, fail("must match exactly one schema in oneOf")...)
+	}
+	if not, ok := schema["not"].(map[string]any); ok && len(spec.validate(not, v, ptr)) == 0 {
+		errs = append(errs, fail("must not match the schema in not")...)
+	}
+	return errs
+}
+
+func (spec *OpenAPISpec) countValid(schemas []any, v any, ptr string) int {
+	n := 0
+	for _, sub := range schemas {
+		if sub, ok := sub.(map[string]any); ok && len(spec.validate(sub, v, ptr)) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// regexp compiles and caches a schema pattern.
+// Returns nil for patterns Go cannot compile.
+func (spec *OpenAPISpec) regexp(pattern string) *regexp.Regexp {
+	if re, ok := spec.patterns.Load(pattern); ok {
+		return re.(*regexp.Regexp)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil
+	}
+	spec.patterns.Store(pattern, re)
+	return re
+}
+
+func hasType(v any, t string) bool {
+	switch t {
+	case "null":
+		return v == nil
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == math.Trunc(f)
+	case "array":
+		_, ok := v.([]any)
+		return ok
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	}
+	return false
+}
+
+// number converts a numeric schema keyword, which may have been
+// decoded from JSON or YAML, to float64.
+func number(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// jsonEqual compares two JSON values, treating the numbers of
+// YAML-decoded documents as equal to the float64 of JSON values.
+func jsonEqual(a, b any) bool {
+	if x, ok := number(a); ok {
+		y, ok := number(b)
+		return ok && x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func isJSON(mediaType string) bool {
+	mt, _, err := mime.ParseMediaType(mediaType)
+	if err != nil {
+		return false
+	}
+	return mt == "application/json" || strings.HasSuffix(mt, "+json")
+}
+
+// Verify checks that every operation in the spec is served by a
+// route registered on rtr, returning an error listing the missing ones.
+func (spec *OpenAPISpec) Verify(rtr *Router) error {
+	var errs []error
+	keys := make([]string, 0, len(spec.ops))
+	for key := range spec.ops {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		methods := make([]string, 0, len(spec.ops[key]))
+		for method := range spec.ops[key] {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+		for _, method := range methods {
+			if !rtr.servesOperation(key, method) {
+				errs = append(errs, fmt.Errorf("way: no route for %s %s", strings.ToUpper(method), spec.ops[key][method].path))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// servesOperation reports whether a route serves the
+// path template key with the specified method.
+func (rtr *Router) servesOperation(key, method string) bool {
+	for _, rt := range rtr.routes {
+		if rt.prefix || templateKey(rt.openAPIPath()) != key {
+			continue
+		}
+		for _, m := range openAPIMethods {
+			if m.name == method && rt.hasMethods(m.bit) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,306 @@
+package way
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// mustParseOpenAPI parses a JSON OpenAPI document or fails the test.
+func mustParseOpenAPI(t *testing.T, doc string) *OpenAPISpec {
+	t.Helper()
+	spec, err := ParseOpenAPI([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return spec
+}
+
+// validationErrors decodes the errors of a validation problem.
+func validationErrors(t *testing.T, w *httptest.ResponseRecorder) []string {
+	t.Helper()
+	var p struct {
+		Errors []ValidationError `json:"errors"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatalf("decoding %s: %v", w.Body, err)
+	}
+	var errs []string
+	for _, e := range p.Errors {
+		errs = append(errs, e.Error())
+	}
+	return errs
+}
+
+func TestOpenAPIVerify(t *testing.T) {
+	spec := mustParseOpenAPI(t, `{
+		"openapi": "3.0.3",
+		"paths": {
+			"/": {"get": {}},
+			"/songs/{songId}": {"get": {}, "put": {}},
+			"/bands": {"post": {}}
+		}
+	}`)
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	rtr := NewRouter()
+	rtr.GET("/", h)
+	rtr.GET("/songs/:id", h)
+	rtr.PUT("/songs/:id", h)
+	rtr.POST("/bands", h)
+	if err := spec.Verify(rtr); err != nil {
+		t.Errorf("Verify = %v, want nil", err)
+	}
+
+	rtr = NewRouter()
+	rtr.GET("/songs/:id", h)
+	// prefix routes do not serve operations
+	rtr.POST("/bands/", h)
+	err := spec.Verify(rtr)
+	if err == nil {
+		t.Fatal("Verify = nil, want missing routes")
+	}
+	want := "way: no route for GET /\nway: no route for POST /bands\nway: no route for PUT /songs/{songId}"
+	if err.Error() != want {
+		t.Errorf("Verify = %q, want %q", err, want)
+	}
+}
+
+func TestOpenAPIValidatorTemplates(t *testing.T) {
+	spec := mustParseOpenAPI(t, `{
+		"openapi": "3.1.0",
+		"paths": {
+			"/bands/{bandId}/songs/{songId}": {"get": {"parameters": [
+				{"name": "bandId", "in": "path", "schema": {"type": "string", "minLength": 3}},
+				{"name": "songId", "in": "path", "schema": {"type": "integer"}}
+			]}}
+		}
+	}`)
+	rtr := NewRouter()
+	rtr.ErrorHandler = WriteProblem
+	rtr.Use(spec.Validator())
+	rtr.GET("/bands/:band/songs/:id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		path   string
+		status int
+		want   string
+	}{
+		{path: "/bands/queen/songs/7", status: http.StatusOK},
+		{path: "/bands/queen/songs/seven", status: http.StatusBadRequest, want: "path songId: must be an integer"},
+		{path: "/bands/u2/songs/7", status: http.StatusBadRequest, want: "path bandId: must be at least 3 characters long"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			rtr.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.status == http.StatusOK {
+				return
+			}
+			if errs := validationErrors(t, w); strings.Join(errs, "\n") != tt.want {
+				t.Errorf("errors = %q, want %q", errs, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseOpenAPIYAML(t *testing.T) {
+	spec, err := ParseOpenAPI([]byte(`
+openapi: 3.0.3
+info: {title: Music, version: "1.0"}
+paths:
+  /songs/{songId}:
+    get:
+      parameters:
+        - $ref: '#/components/parameters/SongID'
+components:
+  parameters:
+    SongID:
+      name: songId
+      in: path
+      schema:
+        type: integer
+        minimum: 1
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rtr := NewRouter()
+	rtr.ErrorHandler = WriteProblem
+	rtr.Use(spec.Validator())
+	rtr.GET("/songs/:id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	if err := spec.Verify(rtr); err != nil {
+		t.Errorf("Verify = %v", err)
+	}
+	w := httptest.NewRecorder()
+	rtr.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/songs/0", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", w.Code)
+	}
+	if errs := validationErrors(t, w); len(errs) != 1 || errs[0] != "path songId: must be >= 1" {
+		t.Errorf("errors = %q", errs)
+	}
+
+	for _, doc := range []string{"- openapi: 3.0.3\n", "openapi: [3.0.3\n", "openapi: 2.0\n"} {
+		if _, err := ParseOpenAPI([]byte(doc)); err == nil {
+			t.Errorf("ParseOpenAPI(%q) = nil error", doc)
+		}
+	}
+}
+
+func TestOpenAPIValidator(t *testing.T) {
+	spec := mustParseOpenAPI(t, `{
+		"openapi": "3.0.3",
+		"paths": {
+			"/songs/{id}": {
+				"parameters": [{"name": "id", "in": "path", "schema": {"type": "integer", "minimum": 1}}],
+				"get": {"parameters": [
+					{"name": "limit", "in": "query", "schema": {"type": "integer", "maximum": 100, "exclusiveMaximum": true}},
+					{"name": "tags", "in": "query", "schema": {"type": "array", "items": {"type": "string", "enum": ["rock", "pop"]}}},
+					{"name": "lyrics", "in": "query", "schema": {"type": "boolean"}},
+					{"name": "X-Rating", "in": "header", "schema": {"type": "number", "exclusiveMinimum": 0}},
+					{"name": "session", "in": "cookie", "required": true, "schema": {"type": "string", "pattern": "^[a-f0-9]+$"}}
+				]},
+				"put": {"requestBody": {"required": true, "content": {
+					"application/json": {"schema": {"$ref": "#/components/schemas/Song"}}
+				}}}
+			},
+			"/bands": {
+				"post": {"requestBody": {"content": {
+					"application/json": {"schema": {"$ref": "#/components/schemas/Band"}}
+				}}}
+			}
+		},
+		"components": {"schemas": {
+			"Song": {
+				"type": "object",
+				"required": ["title"],
+				"additionalProperties": false,
+				"properties": {
+					"title": {"type": "string", "minLength": 1},
+					"rating": {"type": "number", "minimum": 0, "exclusiveMinimum": true},
+					"score": {"type": "number", "exclusiveMaximum": 10},
+					"plays": {"type": "integer", "minimum": 0, "exclusiveMinimum": false}
+				}
+			},
+			"Named": {"type": "object", "required": ["name"], "properties": {"name": {"type": "string"}}},
+			"Band": {
+				"type": "object",
+				"properties": {
+					"name": {"type": "string"},
+					"members": {"type": "array", "items": {"type": "string"}},
+					"genre": {"type": "string"},
+					"solo": {"type": "boolean"}
+				},
+				"additionalProperties": {"type": "string"},
+				"allOf": [{"$ref": "#/components/schemas/Named"}, {"properties": {"members": {"minItems": 1}}}],
+				"anyOf": [{"required": ["members"]}, {"required": ["solo"]}],
+				"oneOf": [{"required": ["genre"]}, {"properties": {"genre": {"const": "rock"}}}],
+				"not": {"required": ["name"], "properties": {"name": {"const": "nobody"}}}
+			}
+		}}
+	}`)
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	rtr := NewRouter()
+	rtr.ErrorHandler = WriteProblem
+	rtr.Use(spec.Validator())
+	rtr.GET("/songs/:id", ok)
+	rtr.PUT("/songs/:id", ok)
+	rtr.POST("/bands", ok)
+	rtr.GET("/unspecified", ok)
+
+	const cookie = "session=ab12"
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		headers map[string]string
+		body    string
+		// want are the validation errors, none for a valid request
+		want []string
+	}{
+		{name: "valid parameters", method: http.MethodGet, path: "/songs/7?limit=99&tags=rock,pop&lyrics=true",
+			headers: map[string]string{"X-Rating": "2.5", "Cookie": cookie}},
+		{name: "repeated array parameter", method: http.MethodGet, path: "/songs/7?tags=rock&tags=pop",
+			headers: map[string]string{"Cookie": cookie}},
+		{name: "path not an integer", method: http.MethodGet, path: "/songs/x",
+			headers: map[string]string{"Cookie": cookie}, want: []string{"path id: must be an integer"}},
+		{name: "path minimum", method: http.MethodGet, path: "/songs/0",
+			headers: map[string]string{"Cookie": cookie}, want: []string{"path id: must be >= 1"}},
+		{name: "boolean exclusive maximum", method: http.MethodGet, path: "/songs/7?limit=100",
+			headers: map[string]string{"Cookie": cookie}, want: []string{"query limit: must be < 100"}},
+		{name: "array item enum", method: http.MethodGet, path: "/songs/7?tags=rock,metal",
+			headers: map[string]string{"Cookie": cookie}, want: []string{"query tags: must be one of the allowed values"}},
+		{name: "query not a boolean", method: http.MethodGet, path: "/songs/7?lyrics=maybe",
+			headers: map[string]string{"Cookie": cookie}, want: []string{"query lyrics: must be a boolean"}},
+		{name: "numeric exclusive minimum", method: http.MethodGet, path: "/songs/7",
+			headers: map[string]string{"X-Rating": "0", "Cookie": cookie}, want: []string{"header X-Rating: must be > 0"}},
+		{name: "header not a number", method: http.MethodGet, path: "/songs/7",
+			headers: map[string]string{"X-Rating": "high", "Cookie": cookie}, want: []string{"header X-Rating: must be a number"}},
+		{name: "cookie pattern", method: http.MethodGet, path: "/songs/7",
+			headers: map[string]string{"Cookie": "session=XYZ"}, want: []string{"cookie session: must match pattern ^[a-f0-9]+$"}},
+		{name: "every error", method: http.MethodGet, path: "/songs/0?limit=abc",
+			want: []string{"path id: must be >= 1", "query limit: must be an integer", "cookie session: is required"}},
+
+		{name: "valid body", method: http.MethodPut, path: "/songs/7", body: `{"title":"Bohemian","rating":0.5,"score":9.5,"plays":0}`},
+		{name: "required body", method: http.MethodPut, path: "/songs/7", want: []string{"body: is required"}},
+		{name: "required property", method: http.MethodPut, path: "/songs/7", body: `{}`, want: []string{"body /title: is required"}},
+		{name: "boolean exclusive minimum", method: http.MethodPut, path: "/songs/7", body: `{"title":"a","rating":0}`,
+			want: []string{"body /rating: must be > 0"}},
+		{name: "numeric exclusive maximum", method: http.MethodPut, path: "/songs/7", body: `{"title":"a","score":10}`,
+			want: []string{"body /score: must be < 10"}},
+		{name: "minLength", method: http.MethodPut, path: "/songs/7", body: `{"title":""}`,
+			want: []string{"body /title: must be at least 1 characters long"}},
+		{name: "additional properties not allowed", method: http.MethodPut, path: "/songs/7", body: `{"title":"a","extra":1}`,
+			want: []string{"body /extra: is not allowed"}},
+		{name: "invalid JSON", method: http.MethodPut, path: "/songs/7", body: `[`,
+			want: []string{"body: invalid JSON: unexpected end of JSON input"}},
+		{name: "not JSON", method: http.MethodPut, path: "/songs/7", body: `title`, headers: map[string]string{"Content-Type": "text/plain"},
+			want: []string{"body: unsupported content type text/plain"}},
+
+		{name: "optional body", method: http.MethodPost, path: "/bands"},
+		{name: "valid combinators", method: http.MethodPost, path: "/bands", body: `{"name":"Queen","members":["Freddie"],"genre":"pop","label":"EMI"}`},
+		{name: "allOf reference", method: http.MethodPost, path: "/bands", body: `{"members":["Freddie"]}`,
+			want: []string{"body /name: is required"}},
+		{name: "allOf constraint", method: http.MethodPost, path: "/bands", body: `{"name":"Queen","members":[]}`,
+			want: []string{"body /members: must have at least 1 items"}},
+		{name: "anyOf", method: http.MethodPost, path: "/bands", body: `{"name":"Queen"}`,
+			want: []string{"body: must match at least one schema in anyOf"}},
+		{name: "oneOf", method: http.MethodPost, path: "/bands", body: `{"name":"Queen","solo":false,"genre":"rock"}`,
+			want: []string{"body: must match exactly one schema in oneOf"}},
+		{name: "not", method: http.MethodPost, path: "/bands", body: `{"name":"nobody","solo":true}`,
+			want: []string{"body: must not match the schema in not"}},
+		{name: "additional properties schema", method: http.MethodPost, path: "/bands", body: `{"name":"Queen","solo":true,"label":5}`,
+			want: []string{"body /label: must be of type string"}},
+
+		{name: "unspecified operation", method: http.MethodGet, path: "/unspecified?limit=abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			rtr.ServeHTTP(w, r)
+			if tt.want == nil {
+				if w.Code != http.StatusOK {
+					t.Errorf("status = %d, want 200: %s", w.Code, w.Body)
+				}
+				return
+			}
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400: %s", w.Code, w.Body)
+			}
+			if errs := validationErrors(t, w); !slices.Equal(errs, tt.want) {
+				t.Errorf("errors = %q, want %q", errs, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package way
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"maps"
+	"net/http"
+	"strings"
+)
+
+// Problem is an RFC 9457 (formerly RFC 7807) problem details object
+// describing an error in an HTTP response.
+type Problem struct {
+	// Type is a URI reference identifying the problem type.
+	// Omitted when empty, which means "about:blank".
+	Type string
+	// Title is a short summary of the problem type.
+	Title string
+	// Status is the HTTP status code.
+	Status int
+	// Detail is an explanation specific to this occurrence.
+	Detail string
+	// Instance is a URI reference identifying this occurrence.
+	// WriteProblem fills it with the request URI when empty.
+	Instance string
+	// Extensions are additional members included in the object.
+	Extensions map[string]any
+}
+
+// NewProblem makes a Problem for the specified status code,
+// using the standard status text as title.
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// Error implements the error interface.
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return fmt.Sprintf("%d %s: %s", p.Status, p.Title, p.Detail)
+	}
+	return fmt.Sprintf("%d %s", p.Status, p.Title)
+}
+
+// MarshalJSON encodes the problem as a flat JSON object with
+// the extension members alongside the standard ones.
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	m := make(map[string]any, len(p.Extensions)+5)
+	for k, v := range p.Extensions {
+		m[k] = v
+	}
+	if p.Type != "" {
+		m["type"] = p.Type
+	}
+	if p.Title != "" {
+		m["title"] = p.Title
+	}
+	if p.Status != 0 {
+		m["status"] = p.Status
+	}
+	if p.Detail != "" {
+		m["detail"] = p.Detail
+	}
+	if p.Instance != "" {
+		m["instance"] = p.Instance
+	}
+	return json.Marshal(m)
+}
+
+// WriteProblem writes p to w, negotiating the representation against
+// the Accept header of r: application/problem+json for API clients,
+// HTML for browsers and plain text otherwise. The ID given by the
+// RequestID middleware is added as the "request_id" extension.
+// It can be assigned to Router.ErrorHandler.
+func WriteProblem(w http.ResponseWriter, r *http.Request, p *Problem) {
+	// p may be shared between requests, e.g. a package-level variable
+	cp := *p
+	p = &cp
+	if p.Instance == "" {
+		p.Instance = r.URL.RequestURI()
+	}
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+	if id := RequestIDFrom(r.Context()); id != "" {
+		if _, ok := p.Extensions["request_id"]; !ok {
+			// the copy still shares the map of p
+			p.Extensions = maps.Clone(p.Extensions)
+			if p.Extensions == nil {
+				p.Extensions = map[string]any{}
+			}
+			p.Extensions["request_id"] = id
+		}
+	}
+
+	h := w.Header()
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Add("Vary", "Accept")
+
+	offers := []string{"application/problem+json", "application/json", "text/html", "text/plain"}
+	switch negotiate(r.Header.Get("Accept"), offers) {
+	case "text/html":
+		h.Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(p.Status)
+		fmt.Fprintf(w, "<!DOCTYPE html>\n<html><head><title>%d %s</title></head>\n<body><h1>%d %s</h1>\n",
+			p.Status, html.EscapeString(p.Title), p.Status, html.EscapeString(p.Title))
+		if p.Detail != "" {
+			fmt.Fprintf(w, "<p>%s</p>\n", html.EscapeString(p.Detail))
+		}
+		fmt.Fprint(w, "</body></html>\n")
+	case "text/plain":
+		h.Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(p.Status)
+		fmt.Fprintf(w, "%d %s\n", p.Status, strings.ToLower(p.Title))
+		if p.Detail != "" {
+			fmt.Fprintln(w, p.Detail)
+		}
+	default:
+		h.Set("Content-Type", "application/problem+json")
+		w.WriteHeader(p.Status)
+		json.NewEncoder(w).Encode(p)
+	}
+}
+
+// RenderError writes p with the ErrorHandler of the Router serving r,
+// so that middleware and handlers report errors the same way as the
+// router itself. Without an ErrorHandler p is written as plain text.
+func RenderError(w http.ResponseWriter, r *http.Request, p *Problem) {
+	rtr, ok := r.Context().Value(routerContextKey{}).(*Router)
+	if !ok {
+		rtr = &Router{}
+	}
+	rtr.renderError(w, r, p)
+}
+
+// renderError writes an error generated by the router itself,
+// through ErrorHandler when set or as plain text otherwise.
+func (rtr *Router) renderError(w http.ResponseWriter, r *http.Request, p *Problem) {
+	if rtr.ErrorHandler != nil {
+		rtr.ErrorHandler(w, r, p)
+		return
+	}
+	if p.Status == http.StatusNotFound && p.Detail == "" {
+		http.NotFound(w, r)
+		return
+	}
+	title := p.Title
+	if title == "" {
+		title = http.StatusText(p.Status)
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	fmt.Fprintf(w, "%d %s\n", p.Status, strings.ToLower(title))
+	if p.Detail != "" {
+		fmt.Fprintln(w, p.Detail)
+	}
+}
@@ -0,0 +1,157 @@
+package way
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteProblem(t *testing.T) {
+	shared := &Problem{Type: "https://example.com/probs/out-of-tune", Status: http.StatusConflict, Detail: "The <song> is out of tune."}
+
+	tests := []struct {
+		name        string
+		accept      string
+		contentType string
+		body        []string
+	}{
+		{name: "problem json", accept: "application/problem+json", contentType: "application/problem+json", body: []string{`"type":"https://example.com/probs/out-of-tune"`, `"title":"Conflict"`, `"status":409`, `"instance":"/songs/1?key=c"`}},
+		{name: "json", accept: "application/json", contentType: "application/problem+json", body: []string{`"status":409`}},
+		{name: "any", accept: "*/*", contentType: "application/problem+json", body: []string{`"status":409`}},
+		{name: "no accept", contentType: "application/problem+json", body: []string{`"status":409`}},
+		{name: "browser", accept: "text/html,application/xhtml+xml,*/*;q=0.8", contentType: "text/html; charset=utf-8", body: []string{"<h1>409 Conflict</h1>", "The &lt;song&gt; is out of tune."}},
+		{name: "plain text", accept: "text/plain", contentType: "text/plain; charset=utf-8", body: []string{"409 conflict\nThe <song> is out of tune.\n"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/songs/1?key=c", nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			WriteProblem(w, r, shared)
+			if w.Code != http.StatusConflict {
+				t.Errorf("status = %d, want 409", w.Code)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != tt.contentType {
+				t.Errorf("Content-Type = %q, want %q", ct, tt.contentType)
+			}
+			for _, s := range tt.body {
+				if !strings.Contains(w.Body.String(), s) {
+					t.Errorf("body %q does not contain %q", w.Body, s)
+				}
+			}
+		})
+	}
+	if shared.Title != "" || shared.Instance != "" {
+		t.Errorf("shared problem was modified: %+v", shared)
+	}
+}
+
+func TestProblemJSON(t *testing.T) {
+	p := NewProblem(http.StatusBadRequest, "Invalid song.")
+	p.Extensions = map[string]any{"errors": []string{"key"}, "status": 999}
+	b, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]any
+	json.Unmarshal(b, &m)
+	// the standard members win over extensions
+	if m["status"] != float64(400) || m["title"] != "Bad Request" || m["detail"] != "Invalid song." || m["errors"] == nil {
+		t.Errorf("problem = %s", b)
+	}
+	if _, ok := m["type"]; ok {
+		t.Errorf("empty type was included: %s", b)
+	}
+}
+
+func TestRouterErrors(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		name         string
+		setup        func(rtr *Router)
+		path         string
+		status       int
+		contentType  string
+		bodyContains string
+	}{
+		{
+			name:        "default not found",
+			path:        "/nowhere",
+			status:      http.StatusNotFound,
+			contentType: "text/plain; charset=utf-8",
+		},
+		{
+			name:        "problem not found",
+			setup:       func(rtr *Router) { rtr.ErrorHandler = WriteProblem },
+			path:        "/nowhere",
+			status:      http.StatusNotFound,
+			contentType: "application/problem+json",
+		},
+		{
+			name: "wrapped not found",
+			setup: func(rtr *Router) {
+				rtr.NotFound = mark(rtr.NotFound)
+			},
+			path:         "/nowhere",
+			status:       http.StatusNotFound,
+			bodyContains: "marked",
+		},
+		{
+			name: "custom not found",
+			setup: func(rtr *Router) {
+				rtr.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { http.Error(w, "lost", http.StatusNotFound) })
+			},
+			path:         "/nowhere",
+			status:       http.StatusNotFound,
+			bodyContains: "lost",
+		},
+		{
+			name:        "body too large",
+			setup:       func(rtr *Router) { rtr.ErrorHandler = WriteProblem },
+			path:        "/upload",
+			status:      http.StatusRequestEntityTooLarge,
+			contentType: "application/problem+json",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rtr := NewRouter()
+			rtr.GET("/songs", ok)
+			rtr.POST("/upload", ok, MaxBodySize(4))
+			if tt.setup != nil {
+				tt.setup(rtr)
+			}
+			w := httptest.NewRecorder()
+			method := http.MethodGet
+			body := ""
+			if tt.path == "/upload" {
+				method, body = http.MethodPost, "far too much"
+			}
+			r := httptest.NewRequest(method, tt.path, strings.NewReader(body))
+			r.Header.Set("Accept", "application/json")
+			rtr.ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.contentType != "" && w.Header().Get("Content-Type") != tt.contentType {
+				t.Errorf("Content-Type = %q, want %q", w.Header().Get("Content-Type"), tt.contentType)
+			}
+			if !strings.Contains(w.Body.String(), tt.bodyContains) {
+				t.Errorf("body %q does not contain %q", w.Body, tt.bodyContains)
+			}
+		})
+	}
+}
+
+// mark is a middleware appending "marked" to responses.
+func mark(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+		w.Write([]byte("marked"))
+	})
+}
@@ -0,0 +1,252 @@
+package way
+
+import (
+	"context"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BalanceStrategy is the algorithm choosing the upstream of a request.
+type BalanceStrategy int
+
+const (
+	// RoundRobin sends requests to each upstream in turn.
+	RoundRobin BalanceStrategy = iota
+	// LeastConnections sends requests to the upstream with the
+	// fewest requests in flight.
+	LeastConnections
+)
+
+// ProxyTarget configures the upstreams of a Proxy route.
+type ProxyTarget struct {
+	// Upstreams are the base URLs requests are forwarded to,
+	// e.g. "http://10.0.0.1:8080". At least one is required.
+	Upstreams []string
+	// Path rewrites the path of forwarded requests. Its ":name"
+	// segments are replaced by the path parameters of the route, and
+	// a trailing "..." by the rest of the path matched by a prefix
+	// route. By default the path is forwarded unchanged. Either way,
+	// it is joined to the path of the upstream URL.
+	Path string
+	// Balance is by default RoundRobin.
+	Balance BalanceStrategy
+	// MaxFails is the number of consecutive failures, that is errors
+	// connecting or 502, 503 and 504 responses, after which an
+	// upstream is left out for FailTimeout. By default 3 and 10 seconds.
+	// When every upstream is left out, all of them are tried again.
+	MaxFails    int
+	FailTimeout time.Duration
+	// Transport makes the requests. By default http.DefaultTransport.
+	Transport http.RoundTripper
+}
+
+// Proxy adds a route forwarding requests for any method to the
+// upstreams of target, through an httputil.ReverseProxy setting the
+// X-Forwarded headers. If no upstream can be reached, a 502 Problem
+// is rendered. Requests whose path has "." or ".." segments are
+// rejected with 400. Panics if an upstream is not a valid URL.
+func (rtr *Router) Proxy(pattern string, target ProxyTarget, opts ...RouteOption) {
+	if len(target.Upstreams) == 0 {
+		panic("way: Proxy requires at least one upstream")
+	}
+	if target.MaxFails <= 0 {
+		target.MaxFails = 3
+	}
+	if target.FailTimeout <= 0 {
+		target.FailTimeout = 10 * time.Second
+	}
+	p := &proxy{target: target}
+	for _, s := range target.Upstreams {
+		u, err := url.Parse(s)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			panic("way: invalid proxy upstream " + s)
+		}
+		p.upstreams = append(p.upstreams, &upstream{url: u})
+	}
+	p.rp = &httputil.ReverseProxy{
+		Rewrite:        p.rewrite,
+		Transport:      target.Transport,
+		ModifyResponse: p.modifyResponse,
+		ErrorHandler:   p.errorHandler,
+	}
+	rtr.Handle(WAY_WILDCARD, pattern, p, opts...)
+}
+
+type proxy struct {
+	target    ProxyTarget
+	upstreams []*upstream
+	rp        *httputil.ReverseProxy
+	next      atomic.Uint64
+}
+
+// upstream is a server behind a Proxy, with its passive health.
+type upstream struct {
+	url    *url.URL
+	active atomic.Int64
+
+	mu        sync.Mutex
+	fails     int
+	downUntil time.Time
+}
+
+// proxyContextKey is the context key type for storing
+// the proxyAttempt of a request in context.Context.
+type proxyContextKey struct{}
+
+// proxyAttempt is the forwarding of a request to an upstream.
+type proxyAttempt struct {
+	up     *upstream
+	failed atomic.Bool
+}
+
+func (p *proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if hasDotSegment(r.URL.Path) {
+		// the upstream may resolve them to paths outside the route
+		RenderError(w, r, NewProblem(http.StatusBadRequest, `The path must not contain "." or ".." segments.`))
+		return
+	}
+	up := p.pick()
+	up.active.Add(1)
+	defer up.active.Add(-1)
+	att := &proxyAttempt{up: up}
+	p.rp.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), proxyContextKey{}, att)))
+	up.report(att.failed.Load(), p.target)
+}
+
+// pick chooses the upstream of a request among the healthy ones.
+func (p *proxy) pick() *upstream {
+	now := time.Now()
+	healthy := make([]*upstream, 0, len(p.upstreams))
+	for _, up := range p.upstreams {
+		if up.healthy(now) {
+			healthy = append(healthy, up)
+		}
+	}
+	if len(healthy) == 0 {
+		healthy = p.upstreams
+	}
+	if p.target.Balance == LeastConnections {
+		best := healthy[0]
+		for _, up := range healthy[1:] {
+			if up.active.Load() < best.active.Load() {
+				best = up
+			}
+		}
+		return best
+	}
+	return healthy[(p.next.Add(1)-1)%uint64(len(healthy))]
+}
+
+func (p *proxy) rewrite(pr *httputil.ProxyRequest) {
+	att := pr.In.Context().Value(proxyContextKey{}).(*proxyAttempt)
+	if p.target.Path != "" {
+		pr.Out.URL.Path = rewritePath(p.target.Path, pr.In)
+		pr.Out.URL.RawPath = ""
+	}
+	pr.SetURL(att.up.url)
+	pr.SetXForwarded()
+}
+
+func (p *proxy) modifyResponse(resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		if att, ok := resp.Request.Context().Value(proxyContextKey{}).(*proxyAttempt); ok {
+			att.failed.Store(true)
+		}
+	}
+	return nil
+}
+
+func (p *proxy) errorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	if r.Context().Err() != nil {
+		// the client went away, not the upstream's fault
+		return
+	}
+	if att, ok := r.Context().Value(proxyContextKey{}).(*proxyAttempt); ok {
+		att.failed.Store(true)
+	}
+	RenderError(w, r, NewProblem(http.StatusBadGateway, "The upstream server could not be reached."))
+}
+
+func (up *upstream) healthy(now time.Time) bool {
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	return !now.Before(up.downUntil)
+}
+
+// report records the outcome of a request, leaving the upstream out
+// after too many consecutive failures.
+func (up *upstream) report(failed bool, target ProxyTarget) {
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	if !failed {
+		up.fails = 0
+		return
+	}
+	up.fails++
+	if up.fails >= target.MaxFails {
+		up.fails = 0
+		up.downUntil = time.Now().Add(target.FailTimeout)
+	}
+}
+
+// rewritePath expands a ProxyTarget.Path template for r.
+func rewritePath(tmpl string, r *http.Request) string {
+	rest, prefix := strings.CutSuffix(tmpl, "...")
+	segs := strings.Split(rest, "/")
+	for i, seg := range segs {
+		if name, ok := strings.CutPrefix(seg, ":"); ok {
+			segs[i] = Param(r.Context(), name)
+		}
+	}
+	path := strings.Join(segs, "/")
+	if prefix {
+		path = strings.TrimSuffix(path, "/")
+		if rt := routeFromContext(r.Context()); rt != nil {
+			if tail := rt.tail(r.URL.Path); tail != "" {
+				path += "/" + tail
+			} else if strings.HasSuffix(r.URL.Path, "/") {
+				path += "/"
+			}
+		}
+	}
+	return path
+}
+
+// hasDotSegment reports whether path has a "." or ".." segment,
+// which would also be in the path parameters or the tail of a route.
+func hasDotSegment(path string) bool {
+	for _, seg := range strings.Split(path, "/") {
+		if seg == "." || seg == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// tail returns the part of path matched by the end of a prefix route:
+// the "..." of "/files/..." or what follows "/files/".
+func (rt *route) tail(path string) string {
+	segs := strings.Split(strings.Trim(path, "/"), "/")
+	n := rt.segsLen
+	if last := rt.segs[n-1]; strings.HasSuffix(last, "...") {
+		// the last segment of the route only matches a prefix
+		n--
+		if n < len(segs) {
+			segs[n] = strings.TrimPrefix(segs[n], strings.TrimSuffix(last, "..."))
+		}
+	}
+	if n >= len(segs) {
+		return ""
+	}
+	tail := strings.TrimPrefix(strings.Join(segs[n:], "/"), "/")
+	if tail != "" && strings.HasSuffix(path, "/") {
+		tail += "/"
+	}
+	return tail
+}
@@ -0,0 +1,128 @@
+package way
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// echoUpstream responds with the path of the requests it receives.
+func echoUpstream(t *testing.T, name string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Upstream", name)
+		w.Header().Set("X-Forwarded-Host", r.Header.Get("X-Forwarded-Host"))
+		io.WriteString(w, r.URL.Path)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestProxyPath(t *testing.T) {
+	up := echoUpstream(t, "a")
+	rtr := NewRouter()
+	rtr.Proxy("/api/users/:id/...", ProxyTarget{Upstreams: []string{up.URL + "/base"}, Path: "/v2/users/:id/..."})
+	rtr.Proxy("/files...", ProxyTarget{Upstreams: []string{up.URL}})
+	rtr.Proxy("/static/:name", ProxyTarget{Upstreams: []string{up.URL}, Path: "/assets/:name"})
+	rtr.Proxy("/music/", ProxyTarget{Upstreams: []string{up.URL}, Path: "/v2/..."})
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		want   string
+	}{
+		{name: "params and tail", path: "/api/users/42/posts/7", status: http.StatusOK, want: "/base/v2/users/42/posts/7"},
+		{name: "no tail", path: "/api/users/42", status: http.StatusOK, want: "/base/v2/users/42"},
+		{name: "trailing slash", path: "/api/users/42/", status: http.StatusOK, want: "/base/v2/users/42/"},
+		{name: "tail trailing slash", path: "/api/users/42/posts/", status: http.StatusOK, want: "/base/v2/users/42/posts/"},
+		{name: "unchanged", path: "/files/a/b.txt", status: http.StatusOK, want: "/files/a/b.txt"},
+		{name: "param", path: "/static/site.css", status: http.StatusOK, want: "/assets/site.css"},
+		{name: "dot-dot in tail", path: "/api/users/42/../../../internal/secret", status: http.StatusBadRequest},
+		{name: "dot-dot param", path: "/static/..", status: http.StatusBadRequest},
+		{name: "dot param", path: "/api/users/./posts", status: http.StatusBadRequest},
+		{name: "encoded dot-dot", path: "/api/users/42/%2e%2e/%2E%2E/internal", status: http.StatusBadRequest},
+		{name: "dot-dot unchanged", path: "/files/../internal", status: http.StatusBadRequest},
+		{name: "slash prefix", path: "/music/", status: http.StatusOK, want: "/v2/"},
+		{name: "slash prefix one segment", path: "/music/bands", status: http.StatusOK, want: "/v2/bands"},
+		{name: "slash prefix several segments", path: "/music/songs/7/lyrics", status: http.StatusOK, want: "/v2/songs/7/lyrics"},
+		{name: "slash prefix trailing slash", path: "/music/songs/7/", status: http.StatusOK, want: "/v2/songs/7/"},
+		{name: "dots in names", path: "/static/..hidden", status: http.StatusOK, want: "/assets/..hidden"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "http://example.com"+tt.path, nil)
+			rtr.ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("upstream path = %q, want %q", got, tt.want)
+			}
+			if got := w.Header().Get("X-Forwarded-Host"); got != "example.com" {
+				t.Errorf("X-Forwarded-Host = %q, want example.com", got)
+			}
+		})
+	}
+}
+
+func TestProxyBalance(t *testing.T) {
+	a, b := echoUpstream(t, "a"), echoUpstream(t, "b")
+	rtr := NewRouter()
+	rtr.Proxy("/rr", ProxyTarget{Upstreams: []string{a.URL, b.URL}})
+
+	var got []string
+	for range 4 {
+		w := httptest.NewRecorder()
+		rtr.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/rr", nil))
+		got = append(got, w.Header().Get("X-Upstream"))
+	}
+	if got[0] == got[1] || got[0] != got[2] || got[1] != got[3] {
+		t.Errorf("upstreams = %v, want alternating", got)
+	}
+}
+
+func TestProxyHealth(t *testing.T) {
+	good := echoUpstream(t, "good")
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Upstream", "bad")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer bad.Close()
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	tests := []struct {
+		name      string
+		upstreams []string
+		// want are the upstreams of consecutive requests
+		want []string
+	}{
+		// after 2 failures the bad upstream is left out
+		{name: "failing responses", upstreams: []string{bad.URL, good.URL}, want: []string{"bad", "good", "bad", "good", "good", "good"}},
+		{name: "unreachable", upstreams: []string{closed.URL, good.URL}, want: []string{"", "good", "", "good", "good", "good"}},
+		// every upstream left out means all are tried again
+		{name: "all failing", upstreams: []string{bad.URL}, want: []string{"bad", "bad", "bad"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rtr := NewRouter()
+			rtr.Proxy("/", ProxyTarget{Upstreams: tt.upstreams, MaxFails: 2, FailTimeout: time.Minute})
+			for i, want := range tt.want {
+				w := httptest.NewRecorder()
+				rtr.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+				if got := w.Header().Get("X-Upstream"); got != want {
+					t.Fatalf("request %d: upstream = %q, want %q", i, got, want)
+				}
+				if want == "" && w.Code != http.StatusBadGateway {
+					t.Errorf("request %d: status = %d, want 502", i, w.Code)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package way
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimitStrategy is the algorithm used to limit requests.
+type RateLimitStrategy int
+
+const (
+	// TokenBucket allows bursts of up to Limit requests, refilling
+	// Limit tokens evenly over each Window.
+	TokenBucket RateLimitStrategy = iota
+	// SlidingWindow allows Limit requests in any Window, estimating
+	// the count from the current and previous fixed windows.
+	SlidingWindow
+)
+
+// Rate is a limit of requests per time window.
+type Rate struct {
+	Limit    int
+	Window   time.Duration
+	Strategy RateLimitStrategy
+}
+
+// RateLimitResult is the outcome of taking a request from a limit.
+type RateLimitResult struct {
+	Allowed   bool
+	Remaining int
+	// Reset is the time until the limit is fully available again.
+	Reset time.Duration
+	// RetryAfter is the time until a request is allowed again,
+	// set when the request was not allowed.
+	RetryAfter time.Duration
+}
+
+// RateLimitStore keeps the state of rate limits. Implement it to
+// share limits between processes, e.g. with Redis.
+type RateLimitStore interface {
+	// Take records a request against the limit identified by key.
+	Take(ctx context.Context, key string, rate Rate) (RateLimitResult, error)
+}
+
+// RateLimitOptions configures the RateLimit middleware.
+type RateLimitOptions struct {
+	Rate
+	// Key identifies the client a request is counted against, e.g.
+	// KeyByIP or KeyByHeader("X-API-Key"). By default uses KeyByIP.
+	// Requests for which Key returns "" are counted by IP.
+	Key func(r *http.Request) string
+	// PerRoute keeps a separate limit for each method and route
+	// pattern, e.g. when the middleware is added with Use.
+	PerRoute bool
+	// Store keeps the limits. By default uses a new MemoryStore.
+	Store RateLimitStore
+}
+
+// RateLimit returns a Middleware limiting the rate of requests of
+// each client. Responses carry RateLimit-Limit, RateLimit-Remaining
+// and RateLimit-Reset headers, and requests over the limit get 429
+// Too Many Requests with a Retry-After header. If the store fails,
+// requests are let through.
+func RateLimit(opts RateLimitOptions) Middleware {
+	if opts.Limit <= 0 || opts.Window <= 0 {
+		panic("way: RateLimit needs a positive Limit and Window")
+	}
+	if opts.Key == nil {
+		opts.Key = KeyByIP
+	}
+	if opts.Store == nil {
+		opts.Store = NewMemoryStore()
+	}
+	limit := strconv.Itoa(opts.Limit)
+	policy := limit + ";w=" + strconv.Itoa(int(math.Ceil(opts.Window.Seconds())))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := opts.Key(r)
+			if key == "" {
+				key = KeyByIP(r)
+			}
+			if opts.PerRoute {
+				key = r.Method + " " + RoutePattern(r.Context()) + " " + key
+			}
+			res, err := opts.Store.Take(r.Context(), key, opts.Rate)
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Set("RateLimit-Policy", policy)
+			h.Set("RateLimit-Limit", limit)
+			h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			h.Set("RateLimit-Reset", seconds(res.Reset))
+			if !res.Allowed {
+				h.Set("Retry-After", seconds(res.RetryAfter))
+				RenderError(w, r, NewProblem(http.StatusTooManyRequests, "Rate limit exceeded, retry in "+seconds(res.RetryAfter)+"s."))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// seconds formats d as a whole number of seconds, rounded up.
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// KeyByIP identifies clients by their IP address: the one found by
+// RealIP behind proxies, or else the one of r.RemoteAddr.
+func KeyByIP(r *http.Request) string {
+	return clientIP(r)
+}
+
+// KeyByHeader identifies clients by the value of a request
+// header, such as an API key.
+func KeyByHeader(name string) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// KeyByQuery identifies clients by the value of a query parameter.
+func KeyByQuery(name string) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		return r.URL.Query().Get(name)
+	}
+}
+
+// MemoryStore is a RateLimitStore keeping limits in memory.
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]*limitEntry
+	lastSweep time.Time
+}
+
+type limitEntry struct {
+	window time.Duration
+	seen   time.Time
+
+	// token bucket
+	tokens float64
+
+	// sliding window
+	start     time.Time
+	count     int
+	prevCount int
+}
+
+// NewMemoryStore makes a new MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: map[string]*limitEntry{},
+	}
+}
+
+// Take implements RateLimitStore.
+func (s *MemoryStore) Take(ctx context.Context, key string, rate Rate) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+	e, ok := s.entries[key]
+	if !ok {
+		e = &limitEntry{window: rate.Window, tokens: float64(rate.Limit), start: now.Truncate(rate.Window), seen: now}
+		s.entries[key] = e
+	}
+	if rate.Strategy == SlidingWindow {
+		return e.slidingWindow(now, rate), nil
+	}
+	return e.tokenBucket(now, rate), nil
+}
+
+func (e *limitEntry) tokenBucket(now time.Time, rate Rate) RateLimitResult {
+	perToken := rate.Window / time.Duration(max(rate.Limit, 1))
+	e.tokens = math.Min(float64(rate.Limit), e.tokens+float64(now.Sub(e.seen))/float64(perToken))
+	e.seen = now
+
+	var res RateLimitResult
+	if e.tokens >= 1 {
+		e.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration((1 - e.tokens) * float64(perToken))
+	}
+	res.Remaining = int(e.tokens)
+	res.Reset = time.Duration((float64(rate.Limit) - e.tokens) * float64(perToken))
+	return res
+}
+
+func (e *limitEntry) slidingWindow(now time.Time, rate Rate) RateLimitResult {
+	cur := now.Truncate(rate.Window)
+	if !cur.Equal(e.start) {
+		if cur.Sub(e.start) == rate.Window {
+			e.prevCount = e.count
+		} else {
+			e.prevCount = 0
+		}
+		e.start, e.count = cur, 0
+	}
+	e.seen = now
+
+	elapsed := now.Sub(cur)
+	weight := 1 - float64(elapsed)/float64(rate.Window)
+	estimated := float64(e.prevCount)*weight + float64(e.count)
+
+	res := RateLimitResult{Reset: rate.Window - elapsed}
+	if estimated+1 <= float64(rate.Limit) {
+		e.count++
+		estimated++
+		res.Allowed = true
+	} else if e.count+1 > rate.Limit || e.prevCount == 0 {
+		res.RetryAfter = rate.Window - elapsed
+	} else {
+		// wait until the previous window's share drops enough
+		need := 1 - float64(rate.Limit-e.count-1)/float64(e.prevCount)
+		res.RetryAfter = max(time.Duration(need*float64(rate.Window))-elapsed, 0)
+	}
+	res.Remaining = max(rate.Limit-int(math.Ceil(estimated)), 0)
+	return res
+}
+
+// sweep forgets entries idle for longer than their window,
+// at most once a minute.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for key, e := range s.entries {
+		if now.Sub(e.seen) > 2*e.window {
+			delete(s.entries, key)
+		}
+	}
+}
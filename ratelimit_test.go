@@ -0,0 +1,171 @@
+package way
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// failingStore is a RateLimitStore that is always unavailable.
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, Rate) (RateLimitResult, error) {
+	return RateLimitResult{}, errors.New("store down")
+}
+
+func TestRateLimit(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	type request struct {
+		path   string
+		ip     string
+		apiKey string
+		status int
+	}
+
+	tests := []struct {
+		name     string
+		opts     RateLimitOptions
+		requests []request
+	}{
+		{
+			name: "by IP",
+			opts: RateLimitOptions{Rate: Rate{Limit: 2, Window: time.Minute}},
+			requests: []request{
+				{path: "/a", ip: "192.0.2.1", status: http.StatusOK},
+				{path: "/a", ip: "192.0.2.1", status: http.StatusOK},
+				{path: "/b", ip: "192.0.2.1", status: http.StatusTooManyRequests},
+				{path: "/a", ip: "192.0.2.2", status: http.StatusOK},
+			},
+		},
+		{
+			name: "by header",
+			opts: RateLimitOptions{Rate: Rate{Limit: 1, Window: time.Minute}, Key: KeyByHeader("X-API-Key")},
+			requests: []request{
+				{path: "/a", ip: "192.0.2.1", apiKey: "k1", status: http.StatusOK},
+				{path: "/a", ip: "192.0.2.2", apiKey: "k1", status: http.StatusTooManyRequests},
+				{path: "/a", ip: "192.0.2.1", apiKey: "k2", status: http.StatusOK},
+				// without a key, by IP
+				{path: "/a", ip: "192.0.2.1", status: http.StatusOK},
+				{path: "/a", ip: "192.0.2.1", status: http.StatusTooManyRequests},
+			},
+		},
+		{
+			name: "per route",
+			opts: RateLimitOptions{Rate: Rate{Limit: 1, Window: time.Minute}, PerRoute: true},
+			requests: []request{
+				{path: "/a", ip: "192.0.2.1", status: http.StatusOK},
+				{path: "/b", ip: "192.0.2.1", status: http.StatusOK},
+				{path: "/a", ip: "192.0.2.1", status: http.StatusTooManyRequests},
+			},
+		},
+		{
+			name: "sliding window",
+			opts: RateLimitOptions{Rate: Rate{Limit: 2, Window: time.Hour, Strategy: SlidingWindow}},
+			requests: []request{
+				{path: "/a", ip: "192.0.2.1", status: http.StatusOK},
+				{path: "/a", ip: "192.0.2.1", status: http.StatusOK},
+				{path: "/a", ip: "192.0.2.1", status: http.StatusTooManyRequests},
+			},
+		},
+		{
+			name: "store down",
+			opts: RateLimitOptions{Rate: Rate{Limit: 1, Window: time.Minute}, Store: failingStore{}},
+			requests: []request{
+				{path: "/a", ip: "192.0.2.1", status: http.StatusOK},
+				{path: "/a", ip: "192.0.2.1", status: http.StatusOK},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rtr := NewRouter()
+			rtr.Use(RateLimit(tt.opts))
+			rtr.GET("/a", ok)
+			rtr.GET("/b", ok)
+			for i, req := range tt.requests {
+				w := httptest.NewRecorder()
+				r := httptest.NewRequest(http.MethodGet, req.path, nil)
+				r.RemoteAddr = req.ip + ":1234"
+				if req.apiKey != "" {
+					r.Header.Set("X-API-Key", req.apiKey)
+				}
+				rtr.ServeHTTP(w, r)
+				if w.Code != req.status {
+					t.Fatalf("request %d: status = %d, want %d", i, w.Code, req.status)
+				}
+				if _, down := tt.opts.Store.(failingStore); down {
+					continue
+				}
+				if w.Header().Get("RateLimit-Limit") == "" || w.Header().Get("RateLimit-Policy") == "" {
+					t.Errorf("request %d: missing RateLimit headers: %v", i, w.Header())
+				}
+				if got := w.Header().Get("Retry-After") != ""; got != (req.status == http.StatusTooManyRequests) {
+					t.Errorf("request %d: Retry-After = %q", i, w.Header().Get("Retry-After"))
+				}
+			}
+		})
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	rate := Rate{Limit: 4, Window: 4 * time.Second}
+	start := time.Unix(1000, 0)
+	e := &limitEntry{window: rate.Window, tokens: 4, seen: start}
+
+	tests := []struct {
+		at         time.Duration
+		allowed    bool
+		remaining  int
+		retryAfter time.Duration
+	}{
+		{at: 0, allowed: true, remaining: 3},
+		{at: 0, allowed: true, remaining: 2},
+		{at: 0, allowed: true, remaining: 1},
+		{at: 0, allowed: true, remaining: 0},
+		{at: 0, allowed: false, remaining: 0, retryAfter: time.Second},
+		{at: 500 * time.Millisecond, allowed: false, remaining: 0, retryAfter: 500 * time.Millisecond},
+		{at: time.Second, allowed: true, remaining: 0},
+		// refilled, but never over the limit
+		{at: time.Minute, allowed: true, remaining: 3},
+	}
+	for i, tt := range tests {
+		res := e.tokenBucket(start.Add(tt.at), rate)
+		if res.Allowed != tt.allowed || res.Remaining != tt.remaining || res.RetryAfter != tt.retryAfter {
+			t.Errorf("take %d at %v = %+v, want allowed %v, remaining %d, retry after %v", i, tt.at, res, tt.allowed, tt.remaining, tt.retryAfter)
+		}
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	rate := Rate{Limit: 4, Window: 10 * time.Second, Strategy: SlidingWindow}
+	start := time.Unix(1000, 0) // the start of a window
+	e := &limitEntry{window: rate.Window, start: start}
+
+	tests := []struct {
+		at         time.Duration
+		allowed    bool
+		retryAfter time.Duration
+	}{
+		{at: 0, allowed: true},
+		{at: time.Second, allowed: true},
+		{at: 2 * time.Second, allowed: true},
+		{at: 3 * time.Second, allowed: true},
+		{at: 4 * time.Second, allowed: false, retryAfter: 6 * time.Second},
+		// a quarter of the window in, the previous 4 weigh 3
+		{at: 12500 * time.Millisecond, allowed: true},
+		{at: 12500 * time.Millisecond, allowed: false, retryAfter: 2500 * time.Millisecond},
+		// half way, the previous 4 weigh 2, plus 1
+		{at: 15 * time.Second, allowed: true},
+		// two windows later, the count starts over
+		{at: 30 * time.Second, allowed: true},
+	}
+	for i, tt := range tests {
+		res := e.slidingWindow(start.Add(tt.at), rate)
+		if res.Allowed != tt.allowed || res.RetryAfter != tt.retryAfter {
+			t.Errorf("take %d at %v = %+v, want allowed %v, retry after %v", i, tt.at, res, tt.allowed, tt.retryAfter)
+		}
+	}
+}
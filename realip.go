@@ -0,0 +1,204 @@
+package way
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// clientContextKey is the context key type for storing
+// the ClientInfo of a request in context.Context.
+type clientContextKey struct{}
+
+// ClientInfo describes the client of a request as seen by the first
+// trusted proxy in front of the server.
+type ClientInfo struct {
+	// IP is the address of the client.
+	IP netip.Addr
+	// Scheme is "http" or "https".
+	Scheme string
+	// Host is the host the client requested.
+	Host string
+}
+
+// RealIPOptions configures the RealIP middleware.
+type RealIPOptions struct {
+	// TrustedProxies are the addresses or CIDR prefixes of the proxies
+	// whose forwarding headers are trusted, e.g. "10.0.0.0/8".
+	TrustedProxies []string
+	// RewriteRemoteAddr sets r.RemoteAddr to the address of the client,
+	// for handlers unaware of ClientInfoFrom.
+	RewriteRemoteAddr bool
+}
+
+// RealIP returns a Middleware finding the client behind proxies. The
+// Forwarded header (RFC 7239) or else X-Forwarded-For, X-Forwarded-Proto
+// and X-Forwarded-Host, or else X-Real-IP, are read only from trusted
+// proxies: the client is the nearest address not trusted. Handlers get
+// it with ClientInfoFrom, and KeyByIP uses it.
+// Panics if a trusted proxy is not a valid address or prefix.
+func RealIP(opts RealIPOptions) Middleware {
+	trusted := make([]netip.Prefix, 0, len(opts.TrustedProxies))
+	for _, s := range opts.TrustedProxies {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			a, aerr := netip.ParseAddr(s)
+			if aerr != nil {
+				panic("way: invalid trusted proxy " + s + ": " + err.Error())
+			}
+			p = netip.PrefixFrom(a, a.BitLen())
+		}
+		trusted = append(trusted, p.Masked())
+	}
+	isTrusted := func(a netip.Addr) bool {
+		a = a.Unmap()
+		for _, p := range trusted {
+			if p.Contains(a) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			peer, err := netip.ParseAddrPort(r.RemoteAddr)
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			client := ClientInfo{IP: peer.Addr().Unmap(), Scheme: "http", Host: r.Host}
+			if r.TLS != nil {
+				client.Scheme = "https"
+			}
+			port := peer.Port()
+			if isTrusted(client.IP) {
+				hops := forwardedHops(r.Header)
+				// walk back from the nearest proxy while hops are trusted
+				for i := len(hops) - 1; i >= 0 && isTrusted(client.IP); i-- {
+					if !hops[i].node.IsValid() {
+						break
+					}
+					client.IP = hops[i].node.Addr().Unmap()
+					port = hops[i].node.Port()
+					if hops[i].proto != "" {
+						client.Scheme = strings.ToLower(hops[i].proto)
+					}
+					if hops[i].host != "" {
+						client.Host = hops[i].host
+					}
+				}
+			}
+			if opts.RewriteRemoteAddr {
+				r.RemoteAddr = netip.AddrPortFrom(client.IP, port).String()
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientContextKey{}, client)))
+		})
+	}
+}
+
+// ClientInfoFrom gets the ClientInfo of the request from the specified
+// Context. Returns false if the RealIP middleware did not run.
+func ClientInfoFrom(ctx context.Context) (ClientInfo, bool) {
+	c, ok := ctx.Value(clientContextKey{}).(ClientInfo)
+	return c, ok
+}
+
+// forwardedHop is an entry of the forwarding headers: the address
+// a proxy received the request from, with the scheme and host.
+type forwardedHop struct {
+	node  netip.AddrPort
+	proto string
+	host  string
+}
+
+// forwardedHops parses the forwarding headers, from the client to the
+// nearest proxy. Hops with unknown or obfuscated nodes are invalid.
+func forwardedHops(h http.Header) []forwardedHop {
+	var hops []forwardedHop
+	if fwd := h.Values("Forwarded"); len(fwd) > 0 {
+		for _, elem := range splitList(fwd) {
+			var hop forwardedHop
+			for _, pair := range strings.Split(elem, ";") {
+				k, v, _ := strings.Cut(strings.TrimSpace(pair), "=")
+				v = strings.Trim(v, `"`)
+				switch strings.ToLower(k) {
+				case "for":
+					hop.node = parseNode(v)
+				case "proto":
+					hop.proto = v
+				case "host":
+					hop.host = v
+				}
+			}
+			hops = append(hops, hop)
+		}
+		return hops
+	}
+	if xff := h.Values("X-Forwarded-For"); len(xff) > 0 {
+		nodes := splitList(xff)
+		protos := splitList(h.Values("X-Forwarded-Proto"))
+		hosts := splitList(h.Values("X-Forwarded-Host"))
+		for i, n := range nodes {
+			hop := forwardedHop{node: parseNode(n)}
+			// proxies appending to the lists keep them aligned; else
+			// the values apply to the nearest hop
+			if len(protos) == len(nodes) {
+				hop.proto = protos[i]
+			} else if i == len(nodes)-1 && len(protos) > 0 {
+				hop.proto = protos[len(protos)-1]
+			}
+			if len(hosts) == len(nodes) {
+				hop.host = hosts[i]
+			} else if i == len(nodes)-1 && len(hosts) > 0 {
+				hop.host = hosts[len(hosts)-1]
+			}
+			hops = append(hops, hop)
+		}
+		return hops
+	}
+	if real := h.Get("X-Real-IP"); real != "" {
+		return []forwardedHop{{node: parseNode(real)}}
+	}
+	return nil
+}
+
+// splitList splits comma separated header values.
+func splitList(values []string) []string {
+	var list []string
+	for _, v := range values {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				list = append(list, s)
+			}
+		}
+	}
+	return list
+}
+
+// parseNode parses an address with an optional port, as in
+// "192.0.2.1", "192.0.2.1:80", "2001:db8::1" or "[2001:db8::1]:80".
+func parseNode(s string) netip.AddrPort {
+	if ap, err := netip.ParseAddrPort(s); err == nil {
+		return ap
+	}
+	if a, err := netip.ParseAddr(strings.Trim(s, "[]")); err == nil {
+		return netip.AddrPortFrom(a, 0)
+	}
+	return netip.AddrPort{}
+}
+
+// clientIP is the IP address of the client of r, as found by RealIP
+// or else from r.RemoteAddr.
+func clientIP(r *http.Request) string {
+	if c, ok := ClientInfoFrom(r.Context()); ok {
+		return c.IP.String()
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,147 @@
+package way
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestRealIP(t *testing.T) {
+	opts := RealIPOptions{TrustedProxies: []string{"10.0.0.0/8", "2001:db8::1"}}
+
+	tests := []struct {
+		name    string
+		opts    RealIPOptions
+		remote  string
+		headers map[string]string
+		tls     bool
+		want    ClientInfo
+		// remoteAddr is r.RemoteAddr as seen by handlers
+		remoteAddr string
+	}{
+		{
+			name:   "direct",
+			remote: "192.0.2.1:1234",
+			want:   ClientInfo{IP: netip.MustParseAddr("192.0.2.1"), Scheme: "http", Host: "example.com"},
+		},
+		{
+			name:    "untrusted peer",
+			remote:  "192.0.2.1:1234",
+			headers: map[string]string{"X-Forwarded-For": "198.51.100.7", "X-Forwarded-Proto": "https"},
+			want:    ClientInfo{IP: netip.MustParseAddr("192.0.2.1"), Scheme: "http", Host: "example.com"},
+		},
+		{
+			name:    "X-Forwarded-For",
+			remote:  "10.0.0.1:1234",
+			headers: map[string]string{"X-Forwarded-For": "198.51.100.7", "X-Forwarded-Proto": "https", "X-Forwarded-Host": "music.example"},
+			want:    ClientInfo{IP: netip.MustParseAddr("198.51.100.7"), Scheme: "https", Host: "music.example"},
+		},
+		{
+			name:    "spoofed X-Forwarded-For",
+			remote:  "10.0.0.1:1234",
+			headers: map[string]string{"X-Forwarded-For": "1.1.1.1, 198.51.100.7, 10.0.0.2"},
+			want:    ClientInfo{IP: netip.MustParseAddr("198.51.100.7"), Scheme: "http", Host: "example.com"},
+		},
+		{
+			name:    "only trusted hops",
+			remote:  "10.0.0.1:1234",
+			headers: map[string]string{"X-Forwarded-For": "10.0.0.3, 10.0.0.2"},
+			want:    ClientInfo{IP: netip.MustParseAddr("10.0.0.3"), Scheme: "http", Host: "example.com"},
+		},
+		{
+			name:    "Forwarded",
+			remote:  "10.0.0.1:1234",
+			headers: map[string]string{"Forwarded": `for=198.51.100.7;proto=https;host=music.example, for="[2001:db8::1]:4711"`},
+			want:    ClientInfo{IP: netip.MustParseAddr("198.51.100.7"), Scheme: "https", Host: "music.example"},
+		},
+		{
+			name:    "Forwarded before X-Forwarded-For",
+			remote:  "10.0.0.1:1234",
+			headers: map[string]string{"Forwarded": "for=198.51.100.7", "X-Forwarded-For": "198.51.100.8"},
+			want:    ClientInfo{IP: netip.MustParseAddr("198.51.100.7"), Scheme: "http", Host: "example.com"},
+		},
+		{
+			name:    "obfuscated node",
+			remote:  "10.0.0.1:1234",
+			headers: map[string]string{"Forwarded": "for=_hidden, for=10.0.0.2"},
+			want:    ClientInfo{IP: netip.MustParseAddr("10.0.0.2"), Scheme: "http", Host: "example.com"},
+		},
+		{
+			name:    "X-Real-IP",
+			remote:  "10.0.0.1:1234",
+			headers: map[string]string{"X-Real-IP": "198.51.100.7"},
+			want:    ClientInfo{IP: netip.MustParseAddr("198.51.100.7"), Scheme: "http", Host: "example.com"},
+		},
+		{
+			name:    "trusted IPv6 address",
+			remote:  "[2001:db8::1]:1234",
+			headers: map[string]string{"X-Forwarded-For": "2001:db8::7"},
+			want:    ClientInfo{IP: netip.MustParseAddr("2001:db8::7"), Scheme: "http", Host: "example.com"},
+		},
+		{
+			name:    "untrusted IPv6 address",
+			remote:  "[2001:db8::2]:1234",
+			headers: map[string]string{"X-Forwarded-For": "2001:db8::7"},
+			want:    ClientInfo{IP: netip.MustParseAddr("2001:db8::2"), Scheme: "http", Host: "example.com"},
+		},
+		{
+			name:   "TLS",
+			remote: "192.0.2.1:1234",
+			tls:    true,
+			want:   ClientInfo{IP: netip.MustParseAddr("192.0.2.1"), Scheme: "https", Host: "example.com"},
+		},
+		{
+			name:       "rewrite RemoteAddr",
+			opts:       RealIPOptions{TrustedProxies: opts.TrustedProxies, RewriteRemoteAddr: true},
+			remote:     "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.7:5678"},
+			want:       ClientInfo{IP: netip.MustParseAddr("198.51.100.7"), Scheme: "http", Host: "example.com"},
+			remoteAddr: "198.51.100.7:5678",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.opts.TrustedProxies == nil {
+				tt.opts = opts
+			}
+			var got ClientInfo
+			var remoteAddr, key string
+			h := RealIP(tt.opts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got, _ = ClientInfoFrom(r.Context())
+				remoteAddr, key = r.RemoteAddr, KeyByIP(r)
+			}))
+			r := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+			r.RemoteAddr = tt.remote
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+			h.ServeHTTP(httptest.NewRecorder(), r)
+			if got != tt.want {
+				t.Errorf("client = %+v, want %+v", got, tt.want)
+			}
+			if key != tt.want.IP.String() {
+				t.Errorf("KeyByIP = %q, want %q", key, tt.want.IP)
+			}
+			if tt.remoteAddr == "" {
+				tt.remoteAddr = tt.remote
+			}
+			if remoteAddr != tt.remoteAddr {
+				t.Errorf("RemoteAddr = %q, want %q", remoteAddr, tt.remoteAddr)
+			}
+		})
+	}
+}
+
+func TestRealIPInvalidProxy(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("no panic for an invalid trusted proxy")
+		}
+	}()
+	RealIP(RealIPOptions{TrustedProxies: []string{"10.0.0.0/33"}})
+}
@@ -0,0 +1,119 @@
+package way
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"net/http"
+	"time"
+)
+
+// requestIDContextKey is the context key type for storing
+// the request ID in context.Context.
+type requestIDContextKey struct{}
+
+// RequestIDOptions configures the RequestID middleware.
+type RequestIDOptions struct {
+	// Header carries request IDs in requests and responses.
+	// By default "X-Request-ID".
+	Header string
+	// Generate makes IDs for requests without one.
+	// By default UUIDv7, or set ULID.
+	Generate func() string
+}
+
+// RequestID returns a Middleware giving every request an ID. It is
+// taken from the Header of the request, or else the trace ID of its
+// traceparent header, or else generated. The ID is set in the request
+// and response headers, logged by Logger and included in problems
+// written by WriteProblem. Handlers get it with RequestIDFrom.
+func RequestID(opts RequestIDOptions) Middleware {
+	if opts.Header == "" {
+		opts.Header = "X-Request-ID"
+	}
+	if opts.Generate == nil {
+		opts.Generate = UUIDv7
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(opts.Header)
+			if !validRequestID(id) {
+				id = ""
+				if sc, err := ParseTraceParent(r.Header.Get("traceparent")); err == nil {
+					id = hex.EncodeToString(sc.TraceID[:])
+				}
+			}
+			if id == "" {
+				id = opts.Generate()
+			}
+			r.Header.Set(opts.Header, id)
+			w.Header().Set(opts.Header, id)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDContextKey{}, id)))
+		})
+	}
+}
+
+// RequestIDFrom gets the ID of the request from the specified Context.
+// Returns "" if the RequestID middleware did not run.
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// validRequestID reports whether an incoming request ID is safe to
+// log and echo: not empty, not too long and printable ASCII.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// UUIDv7 makes a time-ordered RFC 9562 UUID version 7,
+// e.g. "01920d2c-7f8a-7b3e-9c41-2f6d0a5e8b17".
+func UUIDv7() string {
+	var u [16]byte
+	rand.Read(u[:])
+	ms := uint64(time.Now().UnixMilli())
+	u[0], u[1], u[2], u[3], u[4], u[5] = byte(ms>>40), byte(ms>>32), byte(ms>>24), byte(ms>>16), byte(ms>>8), byte(ms)
+	u[6] = u[6]&0x0f | 0x70 // version 7
+	u[8] = u[8]&0x3f | 0x80 // variant 10
+	var s [36]byte
+	hex.Encode(s[0:8], u[0:4])
+	s[8] = '-'
+	hex.Encode(s[9:13], u[4:6])
+	s[13] = '-'
+	hex.Encode(s[14:18], u[6:8])
+	s[18] = '-'
+	hex.Encode(s[19:23], u[8:10])
+	s[23] = '-'
+	hex.Encode(s[24:], u[10:])
+	return string(s[:])
+}
+
+// crockford is the Crockford base32 alphabet of ULIDs.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULID makes a lexicographically sortable identifier,
+// e.g. "01J8GTSZWA5M0Y7Q2R1XKJ3D9B".
+func ULID() string {
+	var u [16]byte
+	binary.BigEndian.PutUint64(u[:8], uint64(time.Now().UnixMilli())<<16)
+	rand.Read(u[6:])
+	hi := binary.BigEndian.Uint64(u[:8])
+	lo := binary.BigEndian.Uint64(u[8:])
+	// 26 characters of 5 bits make 130 bits, the top 2 always zero
+	var s [26]byte
+	for i := 25; i >= 0; i-- {
+		s[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(s[:])
+}
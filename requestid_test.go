@@ -0,0 +1,122 @@
+package way
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+	uuidV7 := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    *regexp.Regexp
+	}{
+		{name: "generated", want: uuidV7},
+		{name: "from header", headers: map[string]string{"X-Request-ID": "abc-123"}, want: regexp.MustCompile(`^abc-123$`)},
+		{name: "from traceparent", headers: map[string]string{"traceparent": "00-" + traceID + "-00f067aa0ba902b7-01"}, want: regexp.MustCompile(`^` + traceID + `$`)},
+		{name: "header before traceparent", headers: map[string]string{"X-Request-ID": "abc", "traceparent": "00-" + traceID + "-00f067aa0ba902b7-01"}, want: regexp.MustCompile(`^abc$`)},
+		{name: "unprintable header", headers: map[string]string{"X-Request-ID": "abc\x01def"}, want: uuidV7},
+		{name: "header with spaces", headers: map[string]string{"X-Request-ID": "abc def"}, want: uuidV7},
+		{name: "long header", headers: map[string]string{"X-Request-ID": strings.Repeat("a", 129)}, want: uuidV7},
+		{name: "invalid traceparent", headers: map[string]string{"traceparent": "00-" + strings.Repeat("0", 32) + "-00f067aa0ba902b7-01"}, want: uuidV7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var inCtx, inHeader string
+			h := RequestID(RequestIDOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				inCtx = RequestIDFrom(r.Context())
+				inHeader = r.Header.Get("X-Request-ID")
+			}))
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			h.ServeHTTP(w, r)
+			if !tt.want.MatchString(inCtx) {
+				t.Errorf("ID = %q, want %s", inCtx, tt.want)
+			}
+			if inHeader != inCtx || w.Header().Get("X-Request-ID") != inCtx {
+				t.Errorf("request header %q, response header %q, want %q", inHeader, w.Header().Get("X-Request-ID"), inCtx)
+			}
+		})
+	}
+}
+
+func TestRequestIDProblem(t *testing.T) {
+	shared := NewProblem(http.StatusTeapot, "Short and stout.")
+	shared.Extensions = map[string]any{"teapot": true}
+	rtr := NewRouter()
+	rtr.Use(RequestID(RequestIDOptions{Header: "X-Trace", Generate: ULID}))
+	rtr.GET("/tea", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteProblem(w, r, shared)
+	}))
+
+	for _, id := range []string{"first", "second"} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/tea", nil)
+		r.Header.Set("Accept", "application/json")
+		r.Header.Set("X-Trace", id)
+		rtr.ServeHTTP(w, r)
+		var body map[string]any
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if body["request_id"] != id || body["teapot"] != true {
+			t.Errorf("problem = %v, want request_id %s and teapot", body, id)
+		}
+	}
+	if _, ok := shared.Extensions["request_id"]; ok {
+		t.Errorf("shared problem was modified: %v", shared.Extensions)
+	}
+}
+
+func TestIDGenerators(t *testing.T) {
+	tests := []struct {
+		name     string
+		generate func() string
+		want     *regexp.Regexp
+	}{
+		{name: "UUIDv7", generate: UUIDv7, want: regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)},
+		{name: "ULID", generate: ULID, want: regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen := map[string]bool{}
+			prev := ""
+			for range 100 {
+				id := tt.generate()
+				if !tt.want.MatchString(id) {
+					t.Fatalf("ID %q does not match %s", id, tt.want)
+				}
+				if seen[id] {
+					t.Fatalf("duplicate ID %q", id)
+				}
+				seen[id] = true
+				// the time prefix never goes backwards
+				if p := timePrefix(tt.name, id); p < prev {
+					t.Fatalf("ID %q sorts before %q", id, prev)
+				} else {
+					prev = p
+				}
+			}
+		})
+	}
+}
+
+// timePrefix returns the part of an ID encoding its time.
+func timePrefix(kind, id string) string {
+	if kind == "ULID" {
+		return id[:10]
+	}
+	b, _ := hex.DecodeString(strings.ReplaceAll(id, "-", "")[:12])
+	return string(b)
+}
@@ -0,0 +1,117 @@
+package way
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cspNonceContextKey is the context key type for storing
+// the Content-Security-Policy nonce in context.Context.
+type cspNonceContextKey struct{}
+
+// SecurityHeadersOptions configures the SecurityHeaders middleware.
+// Empty fields get the defaults below; set a field to "-" to leave
+// its header out instead.
+type SecurityHeadersOptions struct {
+	// HSTSMaxAge is the max-age of Strict-Transport-Security, sent
+	// on TLS requests only. By default 2 years, negative to omit.
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+	HSTSPreload           bool
+	// ContentSecurityPolicy is omitted by default. Every "{nonce}" in
+	// it is replaced by a source expression with a nonce made for the
+	// request, which handlers get with CSPNonce for inline scripts.
+	ContentSecurityPolicy string
+	// ContentTypeOptions is by default "nosniff".
+	ContentTypeOptions string
+	// ReferrerPolicy is by default "strict-origin-when-cross-origin".
+	ReferrerPolicy string
+	// PermissionsPolicy is omitted by default, e.g.
+	// "camera=(), microphone=(), geolocation=()".
+	PermissionsPolicy string
+	// FrameOptions is the X-Frame-Options header, by default "DENY".
+	FrameOptions string
+}
+
+// SecurityHeaders returns a Middleware setting security related
+// response headers. Added with Use it covers every route; added to a
+// Group or route with With it runs later, so its headers replace the
+// router's ones.
+func SecurityHeaders(opts SecurityHeadersOptions) Middleware {
+	if opts.HSTSMaxAge == 0 {
+		opts.HSTSMaxAge = 2 * 365 * 24 * time.Hour
+	}
+	hsts := "-"
+	if opts.HSTSMaxAge > 0 {
+		hsts = "max-age=" + strconv.FormatInt(int64(opts.HSTSMaxAge/time.Second), 10)
+		if opts.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		if opts.HSTSPreload {
+			hsts += "; preload"
+		}
+	}
+	headers := [][2]string{
+		{"X-Content-Type-Options", orDefault(opts.ContentTypeOptions, "nosniff")},
+		{"Referrer-Policy", orDefault(opts.ReferrerPolicy, "strict-origin-when-cross-origin")},
+		{"Permissions-Policy", orDefault(opts.PermissionsPolicy, "-")},
+		{"X-Frame-Options", orDefault(opts.FrameOptions, "DENY")},
+	}
+	csp := orDefault(opts.ContentSecurityPolicy, "-")
+	nonced := strings.Contains(csp, "{nonce}")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			for _, kv := range headers {
+				setOrDel(h, kv[0], kv[1])
+			}
+			if r.TLS != nil {
+				setOrDel(h, "Strict-Transport-Security", hsts)
+			}
+			if nonced {
+				nonce := make([]byte, 16)
+				rand.Read(nonce)
+				n := base64.StdEncoding.EncodeToString(nonce)
+				h.Set("Content-Security-Policy", strings.ReplaceAll(csp, "{nonce}", "'nonce-"+n+"'"))
+				r = r.WithContext(context.WithValue(r.Context(), cspNonceContextKey{}, n))
+			} else {
+				setOrDel(h, "Content-Security-Policy", csp)
+				if CSPNonce(r.Context()) != "" {
+					// the policy of the router was replaced
+					r = r.WithContext(context.WithValue(r.Context(), cspNonceContextKey{}, ""))
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// CSPNonce gets the Content-Security-Policy nonce of the request from
+// the specified Context, for the nonce attribute of inline scripts
+// and styles. Returns "" if the policy has no nonce.
+func CSPNonce(ctx context.Context) string {
+	n, _ := ctx.Value(cspNonceContextKey{}).(string)
+	return n
+}
+
+func orDefault(v, def string) string {
+	if v == "" {
+		return def
+	}
+	return v
+}
+
+// setOrDel sets the header, or deletes it if the value is "-".
+func setOrDel(h http.Header, key, value string) {
+	if value == "-" {
+		h.Del(key)
+		return
+	}
+	h.Set(key, value)
+}
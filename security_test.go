@@ -0,0 +1,126 @@
+package way
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	tests := []struct {
+		name string
+		opts SecurityHeadersOptions
+		tls  bool
+		// want maps headers to their values, "" for absent ones
+		want map[string]string
+	}{
+		{
+			name: "defaults",
+			want: map[string]string{
+				"X-Content-Type-Options":    "nosniff",
+				"Referrer-Policy":           "strict-origin-when-cross-origin",
+				"X-Frame-Options":           "DENY",
+				"Permissions-Policy":        "",
+				"Content-Security-Policy":   "",
+				"Strict-Transport-Security": "",
+			},
+		},
+		{
+			name: "HSTS over TLS",
+			tls:  true,
+			want: map[string]string{"Strict-Transport-Security": "max-age=63072000"},
+		},
+		{
+			name: "HSTS options",
+			opts: SecurityHeadersOptions{HSTSMaxAge: time.Hour, HSTSIncludeSubdomains: true, HSTSPreload: true},
+			tls:  true,
+			want: map[string]string{"Strict-Transport-Security": "max-age=3600; includeSubDomains; preload"},
+		},
+		{
+			name: "HSTS omitted",
+			opts: SecurityHeadersOptions{HSTSMaxAge: -1},
+			tls:  true,
+			want: map[string]string{"Strict-Transport-Security": ""},
+		},
+		{
+			name: "custom values",
+			opts: SecurityHeadersOptions{
+				ContentSecurityPolicy: "default-src 'self'",
+				ReferrerPolicy:        "no-referrer",
+				PermissionsPolicy:     "camera=()",
+				FrameOptions:          "SAMEORIGIN",
+			},
+			want: map[string]string{
+				"Content-Security-Policy": "default-src 'self'",
+				"Referrer-Policy":         "no-referrer",
+				"Permissions-Policy":      "camera=()",
+				"X-Frame-Options":         "SAMEORIGIN",
+			},
+		},
+		{
+			name: "left out",
+			opts: SecurityHeadersOptions{ContentTypeOptions: "-", ReferrerPolicy: "-", FrameOptions: "-"},
+			want: map[string]string{"X-Content-Type-Options": "", "Referrer-Policy": "", "X-Frame-Options": ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := SecurityHeaders(tt.opts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+			h.ServeHTTP(w, r)
+			for k, v := range tt.want {
+				if got := w.Header().Get(k); got != v {
+					t.Errorf("%s = %q, want %q", k, got, v)
+				}
+			}
+		})
+	}
+}
+
+func TestCSPNonce(t *testing.T) {
+	secure := SecurityHeadersOptions{ContentSecurityPolicy: "script-src {nonce}; style-src {nonce}"}
+	embed := SecurityHeadersOptions{ContentSecurityPolicy: "default-src 'self'", FrameOptions: "-"}
+	page := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, CSPNonce(r.Context()))
+	})
+	rtr := NewRouter()
+	rtr.Use(SecurityHeaders(secure))
+	rtr.GET("/page", page)
+	rtr.Group("/embed", With(SecurityHeaders(embed))).GET("/widget", page)
+
+	nonces := map[string]bool{}
+	for range 2 {
+		w := httptest.NewRecorder()
+		rtr.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/page", nil))
+		n := w.Body.String()
+		if n == "" || nonces[n] {
+			t.Fatalf("nonce %q is empty or reused", n)
+		}
+		nonces[n] = true
+		want := "script-src 'nonce-" + n + "'; style-src 'nonce-" + n + "'"
+		if got := w.Header().Get("Content-Security-Policy"); got != want {
+			t.Errorf("Content-Security-Policy = %q, want %q", got, want)
+		}
+	}
+
+	// the group replaces the router's headers and its nonce
+	w := httptest.NewRecorder()
+	rtr.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/embed/widget", nil))
+	if got := w.Header().Get("Content-Security-Policy"); got != "default-src 'self'" {
+		t.Errorf("Content-Security-Policy = %q", got)
+	}
+	if got := w.Header().Get("X-Frame-Options"); got != "" {
+		t.Errorf("X-Frame-Options = %q, want none", got)
+	}
+	if n := w.Body.String(); n != "" || strings.Contains(w.Header().Get("Content-Security-Policy"), "nonce") {
+		t.Errorf("stale nonce %q", n)
+	}
+}
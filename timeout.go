@@ -0,0 +1,140 @@
+package way
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Timeout limits the time the handler of a route has to respond.
+// The handler gets a Context with the deadline, and its response is
+// buffered until it returns: if it overruns, the client gets the
+// router's TimeoutHandler response instead, and anything the handler
+// writes afterwards is discarded. Not suitable for streaming routes.
+func Timeout(d time.Duration) RouteOption {
+	return func(rt *route) {
+		rt.timeout = d
+	}
+}
+
+// timeoutHandler wraps the handler of a route with its Timeout.
+func (rt *route) timeoutHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), rt.timeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+
+		tw := &timeoutWriter{h: make(http.Header)}
+		done := make(chan struct{})
+		panicked := make(chan any, 1)
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					panicked <- p
+				}
+			}()
+			next.ServeHTTP(tw, r)
+			close(done)
+		}()
+
+		select {
+		case p := <-panicked:
+			panic(p)
+		case <-done:
+			tw.writeTo(w)
+		case <-ctx.Done():
+			// select picks at random if the handler finished
+			// as the deadline passed, so look again
+			select {
+			case p := <-panicked:
+				panic(p)
+			case <-done:
+				tw.writeTo(w)
+				return
+			default:
+			}
+			tw.mu.Lock()
+			tw.timedOut = true
+			tw.mu.Unlock()
+			if ctx.Err() != context.DeadlineExceeded {
+				// the client went away, there is nobody to respond to
+				return
+			}
+			if rtr, ok := r.Context().Value(routerContextKey{}).(*Router); ok && rtr.TimeoutHandler != nil {
+				rtr.TimeoutHandler.ServeHTTP(w, r)
+				return
+			}
+			RenderError(w, r, NewProblem(http.StatusServiceUnavailable, "The request timed out."))
+		}
+	})
+}
+
+// timeoutWriter buffers the response of a handler running with a
+// Timeout. Its own header map and lock keep a handler that overran
+// from racing with the timeout response.
+type timeoutWriter struct {
+	mu       sync.Mutex
+	h        http.Header
+	hCopy    http.Header
+	buf      bytes.Buffer
+	status   int
+	timedOut bool
+}
+
+// writeTo sends the buffered response to w.
+func (tw *timeoutWriter) writeTo(w http.ResponseWriter) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	dst := w.Header()
+	for k, vv := range tw.h {
+		dst[k] = vv
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	w.WriteHeader(tw.status)
+	w.Write(tw.buf.Bytes())
+}
+
+// Header returns the header map of the handler. After WriteHeader,
+// it returns a copy so late changes cannot reach the response.
+func (tw *timeoutWriter) Header() http.Header {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.status != 0 || tw.timedOut {
+		if tw.hCopy == nil {
+			tw.hCopy = tw.h.Clone()
+		}
+		return tw.hCopy
+	}
+	return tw.h
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	return tw.buf.Write(b)
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.status != 0 {
+		return
+	}
+	if code < 100 || code > 999 {
+		panic(fmt.Sprintf("invalid WriteHeader code %v", code))
+	}
+	if code >= http.StatusOK {
+		tw.status = code
+	}
+}
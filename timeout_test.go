@@ -0,0 +1,134 @@
+package way
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTimeout(t *testing.T) {
+	// release lets handlers overrunning their timeout return,
+	// late receives the result of writing after the timeout
+	release, late := make(chan struct{}), make(chan error, 1)
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		// timeoutHandler is the router's TimeoutHandler, if any
+		timeoutHandler http.Handler
+		status         int
+		body           string
+		header         string
+	}{
+		{
+			name: "in time",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Song", "Bohemian")
+				w.WriteHeader(http.StatusCreated)
+				io.WriteString(w, "created")
+			},
+			status: http.StatusCreated,
+			body:   "created",
+			header: "Bohemian",
+		},
+		{
+			name: "implicit status",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, "ok")
+			},
+			status: http.StatusOK,
+			body:   "ok",
+		},
+		{
+			name: "overrun",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Song", "Bohemian")
+				<-release
+				w.Header().Set("X-Late", "true")
+				_, err := io.WriteString(w, "late")
+				late <- err
+			},
+			status: http.StatusServiceUnavailable,
+			body:   "503 service unavailable\nThe request timed out.\n",
+		},
+		{
+			name: "custom timeout handler",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				<-release
+			},
+			timeoutHandler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusGatewayTimeout)
+				io.WriteString(w, "too slow")
+			}),
+			status: http.StatusGatewayTimeout,
+			body:   "too slow",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rtr := NewRouter()
+			rtr.TimeoutHandler = tt.timeoutHandler
+			rtr.GET("/", tt.handler, Timeout(20*time.Millisecond))
+			w := httptest.NewRecorder()
+			rtr.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if w.Body.String() != tt.body {
+				t.Errorf("body = %q, want %q", w.Body, tt.body)
+			}
+			if got := w.Header().Get("X-Song"); got != tt.header {
+				t.Errorf("X-Song = %q, want %q", got, tt.header)
+			}
+		})
+	}
+
+	close(release)
+	if err := <-late; !errors.Is(err, http.ErrHandlerTimeout) {
+		t.Errorf("late write = %v, want http.ErrHandlerTimeout", err)
+	}
+}
+
+func TestTimeoutDeadline(t *testing.T) {
+	var deadline time.Time
+	rtr := NewRouter()
+	rtr.GET("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deadline, _ = r.Context().Deadline()
+	}), Timeout(time.Minute))
+	rtr.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if d := time.Until(deadline); d <= 0 || d > time.Minute {
+		t.Errorf("deadline in %v, want within a minute", d)
+	}
+}
+
+func TestTimeoutCanceled(t *testing.T) {
+	rtr := NewRouter()
+	rtr.GET("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}), Timeout(time.Minute))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w := httptest.NewRecorder()
+	rtr.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+	// nobody is left to respond to
+	if w.Code != http.StatusOK || w.Body.Len() != 0 {
+		t.Errorf("status = %d, body = %q, want nothing written", w.Code, w.Body)
+	}
+}
+
+func TestTimeoutPanic(t *testing.T) {
+	rtr := NewRouter()
+	rtr.GET("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("broken")
+	}), Timeout(time.Minute))
+	defer func() {
+		if p := recover(); p != "broken" {
+			t.Errorf("panic = %v, want broken", p)
+		}
+	}()
+	rtr.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	t.Error("the panic of the handler was not propagated")
+}
@@ -0,0 +1,165 @@
+package way
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// spanContextKey is the context key type for storing
+// the request span in context.Context.
+type spanContextKey struct{}
+
+// SpanContext identifies a span as propagated by the W3C Trace
+// Context traceparent and tracestate headers.
+type SpanContext struct {
+	TraceID    [16]byte
+	SpanID     [8]byte
+	Flags      byte
+	TraceState string
+	// Remote is true for a span context received from a client.
+	Remote bool
+}
+
+// IsValid reports whether sc has non-zero trace and span IDs.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// Sampled reports whether the sampled flag is set.
+func (sc SpanContext) Sampled() bool {
+	return sc.Flags&0x01 != 0
+}
+
+// TraceParent formats sc as a traceparent header value.
+func (sc SpanContext) TraceParent() string {
+	return "00-" + hex.EncodeToString(sc.TraceID[:]) + "-" +
+		hex.EncodeToString(sc.SpanID[:]) + "-" + hex.EncodeToString([]byte{sc.Flags})
+}
+
+// Inject sets the traceparent and tracestate headers of h from sc,
+// for propagating the trace to outgoing requests.
+func (sc SpanContext) Inject(h http.Header) {
+	if !sc.IsValid() {
+		return
+	}
+	h.Set("traceparent", sc.TraceParent())
+	if sc.TraceState != "" {
+		h.Set("tracestate", sc.TraceState)
+	} else {
+		h.Del("tracestate")
+	}
+}
+
+// ErrInvalidTraceParent is returned by ParseTraceParent for a
+// malformed traceparent header value.
+var ErrInvalidTraceParent = errors.New("way: invalid traceparent")
+
+// ParseTraceParent parses a traceparent header value.
+func ParseTraceParent(v string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[1]) != 32 ||
+		len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return SpanContext{}, ErrInvalidTraceParent
+	}
+	// version 00 has exactly four fields, later versions may add more
+	if parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return SpanContext{}, ErrInvalidTraceParent
+	}
+	for _, part := range parts[:4] {
+		if strings.ToLower(part) != part {
+			return SpanContext{}, ErrInvalidTraceParent
+		}
+	}
+	var version, flags [1]byte
+	if _, err := hex.Decode(version[:], []byte(parts[0])); err != nil {
+		return SpanContext{}, ErrInvalidTraceParent
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return SpanContext{}, ErrInvalidTraceParent
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}, ErrInvalidTraceParent
+	}
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return SpanContext{}, ErrInvalidTraceParent
+	}
+	sc.Flags = flags[0]
+	if !sc.IsValid() {
+		return SpanContext{}, ErrInvalidTraceParent
+	}
+	return sc, nil
+}
+
+// Tracer starts server spans. It mirrors the small part of the
+// OpenTelemetry API the router needs, so an adapter for an
+// OpenTelemetry tracer, or a test stub, can be plugged in without
+// the router depending on it.
+type Tracer interface {
+	// Start starts a span named name as a child of parent, which
+	// is the zero SpanContext if the request carried none, and
+	// returns a context holding the new span.
+	Start(ctx context.Context, name string, parent SpanContext) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	// SpanContext returns the identity of the span.
+	SpanContext() SpanContext
+	// SetAttributes records key-value pairs on the span.
+	SetAttributes(kv map[string]any)
+	// End completes the span with the response status code.
+	End(status int)
+}
+
+// SpanFromContext gets the span started by the Tracing middleware
+// from the specified Context. Returns nil if there is none.
+func SpanFromContext(ctx context.Context) Span {
+	span, _ := ctx.Value(spanContextKey{}).(Span)
+	return span
+}
+
+// Tracing returns a Middleware starting a server span per request
+// with t. Spans are named after the method and matched route
+// pattern, e.g. "GET /music/:band/:song", and continue the trace
+// from the traceparent and tracestate request headers.
+func Tracing(t Tracer) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			parent, err := ParseTraceParent(r.Header.Get("traceparent"))
+			if err == nil {
+				parent.TraceState = r.Header.Get("tracestate")
+				parent.Remote = true
+			}
+
+			name := r.Method
+			attrs := map[string]any{
+				"http.request.method": r.Method,
+				"url.path":            r.URL.Path,
+			}
+			if rt := routeFromContext(r.Context()); rt != nil {
+				name += " " + rt.pattern
+				attrs["http.route"] = rt.pattern
+				if rt.name != "" {
+					attrs["way.route.name"] = rt.name
+				}
+				for _, p := range rt.params {
+					attrs["way.param."+p] = Param(r.Context(), p)
+				}
+			}
+
+			ctx, span := t.Start(r.Context(), name, parent)
+			span.SetAttributes(attrs)
+			ctx = context.WithValue(ctx, spanContextKey{}, span)
+
+			ww, sw := WrapWriter(w)
+			defer func() {
+				span.End(sw.Status())
+			}()
+			next.ServeHTTP(ww, r.WithContext(ctx))
+		})
+	}
+}
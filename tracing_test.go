@@ -0,0 +1,190 @@
+package way
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	const (
+		traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		spanID  = "00f067aa0ba902b7"
+	)
+	sampled := "00-" + traceID + "-" + spanID + "-01"
+	tests := []struct {
+		name  string
+		value string
+		// want is the TraceParent of a valid value
+		want  string
+		flags byte
+	}{
+		{name: "sampled", value: sampled, want: sampled, flags: 1},
+		{name: "not sampled", value: "00-" + traceID + "-" + spanID + "-00", want: "00-" + traceID + "-" + spanID + "-00"},
+		{name: "other flags", value: "00-" + traceID + "-" + spanID + "-0a", want: "00-" + traceID + "-" + spanID + "-0a", flags: 0x0a},
+		{name: "surrounding spaces", value: " " + sampled + " ", want: sampled, flags: 1},
+		{name: "future version", value: "cc-" + traceID + "-" + spanID + "-01-what-the-future-holds", want: sampled, flags: 1},
+		{name: "future version without extra fields", value: "cc-" + traceID + "-" + spanID + "-01", want: sampled, flags: 1},
+		{name: "version ff", value: "ff-" + traceID + "-" + spanID + "-01"},
+		{name: "version 00 with extra fields", value: "00-" + traceID + "-" + spanID + "-01-extra"},
+		{name: "upper case", value: "00-4BF92F3577B34DA6A3CE929D0E0E4736-" + spanID + "-01"},
+		{name: "upper case flags", value: "00-" + traceID + "-" + spanID + "-0A"},
+		{name: "short trace ID", value: "00-" + traceID[1:] + "-" + spanID + "-01"},
+		{name: "long span ID", value: "00-" + traceID + "-" + spanID + "0-01"},
+		{name: "short version", value: "0-" + traceID + "-" + spanID + "-01"},
+		{name: "missing flags", value: "00-" + traceID + "-" + spanID},
+		{name: "zero trace ID", value: "00-00000000000000000000000000000000-" + spanID + "-01"},
+		{name: "zero span ID", value: "00-" + traceID + "-0000000000000000-01"},
+		{name: "not hex", value: "00-" + traceID[:31] + "g-" + spanID + "-01"},
+		{name: "empty", value: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, err := ParseTraceParent(tt.value)
+			if tt.want == "" {
+				if err != ErrInvalidTraceParent || sc != (SpanContext{}) {
+					t.Errorf("ParseTraceParent = %+v, %v; want ErrInvalidTraceParent", sc, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseTraceParent error = %v", err)
+			}
+			if sc.Flags != tt.flags || sc.Sampled() != (tt.flags&1 != 0) {
+				t.Errorf("Flags = %x, want %x", sc.Flags, tt.flags)
+			}
+			if sc.TraceParent() != tt.want {
+				t.Errorf("TraceParent = %s, want %s", sc.TraceParent(), tt.want)
+			}
+		})
+	}
+}
+
+func TestSpanContextInject(t *testing.T) {
+	sc, err := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := http.Header{"Tracestate": {"stale=1"}}
+	sc.Inject(h)
+	if got := h.Get("traceparent"); got != "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01" {
+		t.Errorf("traceparent = %q", got)
+	}
+	if got := h.Get("tracestate"); got != "" {
+		t.Errorf("tracestate = %q, want none", got)
+	}
+	sc.TraceState = "vendor=abc"
+	sc.Inject(h)
+	if got := h.Get("tracestate"); got != "vendor=abc" {
+		t.Errorf("tracestate = %q, want vendor=abc", got)
+	}
+
+	h = http.Header{}
+	SpanContext{}.Inject(h)
+	if len(h) != 0 {
+		t.Errorf("invalid span context injected %v", h)
+	}
+}
+
+// stubTracer records the spans it starts.
+type stubTracer struct {
+	spans []*stubSpan
+}
+
+type stubSpan struct {
+	name   string
+	parent SpanContext
+	attrs  map[string]any
+	status int // 0 until ended
+}
+
+func (t *stubTracer) Start(ctx context.Context, name string, parent SpanContext) (context.Context, Span) {
+	span := &stubSpan{name: name, parent: parent}
+	t.spans = append(t.spans, span)
+	return ctx, span
+}
+
+func (s *stubSpan) SpanContext() SpanContext { return SpanContext{} }
+
+func (s *stubSpan) SetAttributes(kv map[string]any) { s.attrs = kv }
+
+func (s *stubSpan) End(status int) { s.status = status }
+
+func TestTracing(t *testing.T) {
+	tracer := &stubTracer{}
+	var inHandler Span
+	rtr := NewRouter()
+	rtr.Use(Tracing(tracer))
+	rtr.GET("/music/:band/:song", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inHandler = SpanFromContext(r.Context())
+	}), Name("song"))
+	rtr.GET("/broken", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+
+	remote, _ := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	remote.TraceState = "vendor=abc"
+	remote.Remote = true
+
+	tests := []struct {
+		name    string
+		path    string
+		headers map[string]string
+		want    stubSpan
+	}{
+		{
+			name: "route",
+			path: "/music/queen/bohemian",
+			want: stubSpan{
+				name: "GET /music/:band/:song",
+				attrs: map[string]any{
+					"http.request.method": "GET", "url.path": "/music/queen/bohemian", "http.route": "/music/:band/:song",
+					"way.route.name": "song", "way.param.band": "queen", "way.param.song": "bohemian",
+				},
+				status: http.StatusOK,
+			},
+		},
+		{
+			name:    "remote parent",
+			path:    "/broken",
+			headers: map[string]string{"traceparent": remote.TraceParent(), "tracestate": "vendor=abc"},
+			want: stubSpan{
+				name:   "GET /broken",
+				parent: remote,
+				attrs:  map[string]any{"http.request.method": "GET", "url.path": "/broken", "http.route": "/broken"},
+				status: http.StatusInternalServerError,
+			},
+		},
+		{
+			name:    "invalid parent",
+			path:    "/nowhere",
+			headers: map[string]string{"traceparent": "ff-bad", "tracestate": "vendor=abc"},
+			want: stubSpan{
+				name:   "GET",
+				attrs:  map[string]any{"http.request.method": "GET", "url.path": "/nowhere"},
+				status: http.StatusNotFound,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracer.spans = nil
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			rtr.ServeHTTP(httptest.NewRecorder(), r)
+			if len(tracer.spans) != 1 {
+				t.Fatalf("started %d spans, want 1", len(tracer.spans))
+			}
+			if got := *tracer.spans[0]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("span = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+	if inHandler == nil {
+		t.Error("SpanFromContext = nil in the handler")
+	}
+}
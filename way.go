@@ -4,6 +4,7 @@ import (
 	"context"
 	"net/http"
 	"strings"
+	"time"
 )
 
 const ( // HTTP Methods in this router
@@ -22,21 +23,75 @@ const ( // HTTP Methods in this router
 // parameters in context.Context.
 type wayContextKey string
 
+// routeContextKey is the context key type for storing
+// the matched route in context.Context.
+type routeContextKey struct{}
+
+// routerContextKey is the context key type for storing
+// the Router serving a request in context.Context.
+type routerContextKey struct{}
+
+// handlerContextKey is the context key type for storing
+// the handler found by lookup in context.Context.
+type handlerContextKey struct{}
+
+// RouteOption configures a route registered with Handle.
+type RouteOption func(*route)
+
+// Name sets the name of a route, accessible via the RouteName function.
+func Name(name string) RouteOption {
+	return func(rt *route) {
+		rt.name = name
+	}
+}
+
+// Middleware wraps an http.Handler with additional behaviour.
+type Middleware func(http.Handler) http.Handler
+
+// With adds middleware to a route. It runs after the middleware
+// added to the router with Use, in the order it was given.
+func With(mw ...Middleware) RouteOption {
+	return func(rt *route) {
+		rt.middleware = append(rt.middleware, mw...)
+	}
+}
+
 // Router routes HTTP requests.
 type Router struct {
-	routes []*route
+	routes     []*route
+	middleware []Middleware
+	chain      http.Handler // middleware wrapping dispatch
 	// NotFound is the http.Handler to call when no routes
-	// match. By default uses http.NotFoundHandler().
+	// match. By default it renders a 404 Problem.
 	NotFound http.Handler
+	// ErrorHandler renders the errors generated by the router
+	// itself, such as 400 for unknown methods and the 404 of the
+	// default NotFound. Set it to WriteProblem for problem+json responses.
+	// By default errors are written as plain text.
+	ErrorHandler func(w http.ResponseWriter, r *http.Request, p *Problem)
+	// MaxBodySize limits the size of request bodies in bytes for
+	// the routes that do not set their own with the MaxBodySize
+	// option. Larger bodies get 413 Request Entity Too Large, or
+	// fail to read with an *http.MaxBytesError. Zero means no limit.
+	MaxBodySize int64
+	// TimeoutHandler is the http.Handler to call when the handler
+	// of a route overruns its Timeout. If nil, a 503 Problem is
+	// rendered instead.
+	TimeoutHandler http.Handler
 }
 
 // NewRouter makes a new Router.
 func NewRouter() *Router {
 	return &Router{
-		NotFound: http.NotFoundHandler(),
+		NotFound: http.HandlerFunc(notFound),
 	}
 }
 
+// notFound is the default NotFound handler.
+func notFound(w http.ResponseWriter, r *http.Request) {
+	RenderError(w, r, NewProblem(http.StatusNotFound, ""))
+}
+
 func (rtr *Router) pathSegments(p string) []string {
 	return strings.Split(strings.Trim(p, "/"), "/")
 }
@@ -50,7 +105,7 @@ func (rtr *Router) methodToI(m string) int {
 	case "HEAD":
 		return WAY_HEAD
 	case "PUT":
-		return WAY_POST
+		return WAY_PUT
 	case "DELETE":
 		return WAY_DELETE
 	case "OPTIONS":
@@ -68,56 +123,117 @@ func (rtr *Router) methodToI(m string) int {
 // Pattern can contain path segments such as: /item/:id which is
 // accessible via the Param function.
 // If pattern ends with trailing /, it acts as a prefix.
-func (rtr *Router) Handle(methods int, pattern string, handler http.Handler) {
+// Options further configure the route.
+func (rtr *Router) Handle(methods int, pattern string, handler http.Handler, opts ...RouteOption) {
 	segsPath := rtr.pathSegments(pattern)
+	var params []string
+	for _, seg := range segsPath {
+		if strings.HasPrefix(seg, ":") {
+			params = append(params, strings.TrimPrefix(seg, ":"))
+		}
+	}
 	route := &route{
+		pattern: pattern,
+		params:  params,
 		methods: methods,
 		segs:    segsPath,
 		segsLen: len(segsPath),
 		handler: handler,
-		prefix:  strings.HasSuffix(pattern, "/") || strings.HasSuffix(pattern, "..."),
+		// the root only matches itself
+		prefix: pattern != "/" && (strings.HasSuffix(pattern, "/") || strings.HasSuffix(pattern, "...")),
+	}
+	for _, opt := range opts {
+		opt(route)
+	}
+	if route.timeout > 0 {
+		route.handler = route.timeoutHandler(route.handler)
+	}
+	if len(route.produces) > 0 || len(route.consumes) > 0 {
+		route.handler = route.negotiateHandler(route.handler)
+	}
+	if len(route.scopes) > 0 || len(route.roles) > 0 {
+		route.handler = route.authorizeHandler(route.handler)
+	}
+	for i := len(route.middleware) - 1; i >= 0; i-- {
+		route.handler = route.middleware[i](route.handler)
 	}
 	rtr.routes = append(rtr.routes, route)
 }
 
+// Use appends middleware to the router. Middleware runs after
+// routing, in the order it was added, for every request including
+// the ones no route matched, so it can inspect the matched route.
+func (rtr *Router) Use(mw ...Middleware) {
+	rtr.middleware = append(rtr.middleware, mw...)
+	// build the chain once here rather than for every request
+	rtr.chain = http.HandlerFunc(rtr.dispatch)
+	for i := len(rtr.middleware) - 1; i >= 0; i-- {
+		rtr.chain = rtr.middleware[i](rtr.chain)
+	}
+}
+
 // ALL ...
-func (rtr *Router) ALL(pattern string, handler http.Handler) {
-	rtr.Handle(WAY_WILDCARD, pattern, handler)
+func (rtr *Router) ALL(pattern string, handler http.Handler, opts ...RouteOption) {
+	rtr.Handle(WAY_WILDCARD, pattern, handler, opts...)
 }
 
 // GET ...
-func (rtr *Router) GET(pattern string, handler http.Handler) {
-	rtr.Handle(WAY_GET, pattern, handler)
+func (rtr *Router) GET(pattern string, handler http.Handler, opts ...RouteOption) {
+	rtr.Handle(WAY_GET, pattern, handler, opts...)
 }
 
 // HEAD ...
-func (rtr *Router) HEAD(pattern string, handler http.Handler) {
-	rtr.Handle(WAY_HEAD, pattern, handler)
+func (rtr *Router) HEAD(pattern string, handler http.Handler, opts ...RouteOption) {
+	rtr.Handle(WAY_HEAD, pattern, handler, opts...)
 }
 
 // POST ...
-func (rtr *Router) POST(pattern string, handler http.Handler) {
-	rtr.Handle(WAY_POST, pattern, handler)
+func (rtr *Router) POST(pattern string, handler http.Handler, opts ...RouteOption) {
+	rtr.Handle(WAY_POST, pattern, handler, opts...)
 }
 
 // PUT ...
-func (rtr *Router) PUT(pattern string, handler http.Handler) {
-	rtr.Handle(WAY_PUT, pattern, handler)
+func (rtr *Router) PUT(pattern string, handler http.Handler, opts ...RouteOption) {
+	rtr.Handle(WAY_PUT, pattern, handler, opts...)
 }
 
 // DELETE ...
-func (rtr *Router) DELETE(pattern string, handler http.Handler) {
-	rtr.Handle(WAY_DELETE, pattern, handler)
+func (rtr *Router) DELETE(pattern string, handler http.Handler, opts ...RouteOption) {
+	rtr.Handle(WAY_DELETE, pattern, handler, opts...)
 }
 
 // ServeHTTP routes the incoming http.Request based on method and path
 // extracting path parameters as it goes.
 func (rtr *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h, r := rtr.lookup(r)
+	if p := rtr.limitBody(w, r); p != nil {
+		h = rtr.errorHandler(p)
+	}
+	if rtr.chain == nil {
+		h.ServeHTTP(w, r)
+		return
+	}
+	rtr.chain.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), handlerContextKey{}, h)))
+}
+
+// dispatch calls the handler found by lookup, at the end of the
+// middleware chain. If middleware replaced the request context with
+// one not derived from it, the handler is lost and NotFound is called.
+func (rtr *Router) dispatch(w http.ResponseWriter, r *http.Request) {
+	h, ok := r.Context().Value(handlerContextKey{}).(http.Handler)
+	if !ok {
+		h = rtr.notFoundHandler()
+	}
+	h.ServeHTTP(w, r)
+}
+
+// lookup finds the handler for r, returning it together with the
+// request carrying the path parameters and the matched route.
+func (rtr *Router) lookup(r *http.Request) (http.Handler, *http.Request) {
+	rctx := context.WithValue(r.Context(), routerContextKey{}, rtr)
 	reqMethod := rtr.methodToI(r.Method)
 	if reqMethod == 0 {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("400 bad request\n"))
-		return
+		return rtr.errorHandler(NewProblem(http.StatusBadRequest, "")), r.WithContext(rctx)
 	}
 
 	segs := rtr.pathSegments(r.URL.Path)
@@ -125,12 +241,28 @@ func (rtr *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		if !route.hasMethods(reqMethod) {
 			continue
 		}
-		if ctx, ok := route.match(r.Context(), segs); ok {
-			route.handler.ServeHTTP(w, r.WithContext(ctx))
-			return
+		if ctx, ok := route.match(rctx, segs); ok {
+			ctx = context.WithValue(ctx, routeContextKey{}, route)
+			return route.handler, r.WithContext(ctx)
 		}
 	}
-	rtr.NotFound.ServeHTTP(w, r)
+	return rtr.notFoundHandler(), r.WithContext(rctx)
+}
+
+// notFoundHandler returns NotFound, or a handler rendering
+// a 404 Problem if it is nil.
+func (rtr *Router) notFoundHandler() http.Handler {
+	if rtr.NotFound != nil {
+		return rtr.NotFound
+	}
+	return rtr.errorHandler(NewProblem(http.StatusNotFound, ""))
+}
+
+// errorHandler returns an http.Handler rendering p with renderError.
+func (rtr *Router) errorHandler(p *Problem) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rtr.renderError(w, r, p)
+	})
 }
 
 // Param gets the path parameter from the specified Context.
@@ -143,12 +275,52 @@ func Param(ctx context.Context, param string) string {
 	return vStr
 }
 
+// RoutePattern gets the pattern of the route matched for the request
+// carrying the specified Context, e.g. "/music/:band/:song".
+// Returns an empty string if no route matched.
+func RoutePattern(ctx context.Context) string {
+	if rt := routeFromContext(ctx); rt != nil {
+		return rt.pattern
+	}
+	return ""
+}
+
+// RouteName gets the name given with the Name option to the route
+// matched for the request carrying the specified Context.
+// Returns an empty string if no route matched or it has no name.
+func RouteName(ctx context.Context) string {
+	if rt := routeFromContext(ctx); rt != nil {
+		return rt.name
+	}
+	return ""
+}
+
+// routeFromContext returns the route matched for the request
+// carrying ctx, or nil if no route matched.
+func routeFromContext(ctx context.Context) *route {
+	rt, _ := ctx.Value(routeContextKey{}).(*route)
+	return rt
+}
+
 type route struct {
+	pattern string
+	name    string
+	params  []string
 	methods int
 	segs    []string
 	segsLen int
 	handler http.Handler
 	prefix  bool
+	doc     *Operation
+
+	produces    []string
+	consumes    []string
+	middleware  []Middleware
+	timeout     time.Duration
+	maxBodySize int64
+	scopes      []string
+	roles       []string
+	challenge   string
 }
 
 func (rt *route) hasMethods(methods int) bool {
@@ -163,6 +335,10 @@ func (rt *route) match(ctx context.Context, segs []string) (context.Context, boo
 	}
 
 	for i := 0; i < paramSegsLen; i++ {
+		if i == rt.segsLen {
+			// a prefix route matches whatever follows its segments
+			return ctx, true
+		}
 		routeSeg := rt.segs[i]
 		paramSeg := segs[i]
 
@@ -0,0 +1,121 @@
+package way
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMethods(t *testing.T) {
+	rtr := NewRouter()
+	for _, m := range []string{"GET", "POST", "PUT", "DELETE"} {
+		rtr.Handle(rtr.methodToI(m), "/songs/:id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, m)
+		}))
+	}
+	rtr.POST("/bands", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+		want   string
+	}{
+		{method: http.MethodGet, path: "/songs/1", status: http.StatusOK, want: "GET"},
+		{method: http.MethodPost, path: "/songs/1", status: http.StatusOK, want: "POST"},
+		{method: http.MethodPut, path: "/songs/1", status: http.StatusOK, want: "PUT"},
+		{method: http.MethodDelete, path: "/songs/1", status: http.StatusOK, want: "DELETE"},
+		// PUT requests no longer reach POST routes
+		{method: http.MethodPut, path: "/bands", status: http.StatusNotFound},
+		{method: http.MethodPatch, path: "/songs/1", status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			rtr.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.status == http.StatusOK && w.Body.String() != tt.want {
+				t.Errorf("handler = %q, want %q", w.Body, tt.want)
+			}
+		})
+	}
+}
+
+func TestDispatchLostContext(t *testing.T) {
+	rtr := NewRouter()
+	// replaces the request context instead of deriving from it
+	rtr.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.Background()))
+		})
+	})
+	rtr.GET("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	rtr.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	w := httptest.NewRecorder()
+	rtr.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusTeapot {
+		t.Errorf("status = %d, want NotFound's 418", w.Code)
+	}
+
+	rtr.NotFound = nil
+	w = httptest.NewRecorder()
+	rtr.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("without NotFound: status = %d, want 404", w.Code)
+	}
+}
+
+func TestRouteInfo(t *testing.T) {
+	var pattern, name string
+	rtr := NewRouter()
+	// middleware sees the route too, as lookup runs before it
+	rtr.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			pattern, name = RoutePattern(r.Context()), RouteName(r.Context())
+			next.ServeHTTP(w, r)
+		})
+	})
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	rtr.GET("/music/:band/:song", h, Name("song"))
+	rtr.GET("/files/...", h)
+	rtr.GET("/", h, Name("home"))
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		status  int
+		pattern string
+		route   string
+	}{
+		{name: "named", method: http.MethodGet, path: "/music/queen/bohemian", status: http.StatusOK, pattern: "/music/:band/:song", route: "song"},
+		{name: "unnamed", method: http.MethodGet, path: "/files/a/b.txt", status: http.StatusOK, pattern: "/files/..."},
+		{name: "root", method: http.MethodGet, path: "/", status: http.StatusOK, pattern: "/", route: "home"},
+		{name: "not found", method: http.MethodGet, path: "/nowhere", status: http.StatusNotFound},
+		{name: "other method", method: http.MethodPost, path: "/music/queen/bohemian", status: http.StatusNotFound},
+		{name: "bad request", method: http.MethodPatch, path: "/music/queen/bohemian", status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pattern, name = "unset", "unset"
+			w := httptest.NewRecorder()
+			rtr.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if pattern != tt.pattern {
+				t.Errorf("RoutePattern = %q, want %q", pattern, tt.pattern)
+			}
+			if name != tt.route {
+				t.Errorf("RouteName = %q, want %q", name, tt.route)
+			}
+		})
+	}
+}
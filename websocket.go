@@ -0,0 +1,400 @@
+package way
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// websocketGUID is appended to Sec-WebSocket-Key to compute
+// Sec-WebSocket-Accept (RFC 6455, section 4.2.2).
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// MessageType is the type of a WebSocket data message.
+type MessageType int
+
+const (
+	TextMessage   MessageType = 1
+	BinaryMessage MessageType = 2
+)
+
+// WebSocket close codes (RFC 6455, section 7.4.1).
+const (
+	CloseNormal          = 1000
+	CloseGoingAway       = 1001
+	CloseProtocolError   = 1002
+	CloseUnsupportedData = 1003
+	CloseNoStatus        = 1005
+	CloseInvalidPayload  = 1007
+	ClosePolicyViolation = 1008
+	CloseMessageTooBig   = 1009
+	CloseInternalError   = 1011
+)
+
+// CloseError is returned by ReadMessage when the connection was closed
+// with a close frame, by the peer or because of an invalid message.
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("way: websocket closed: %d %s", e.Code, e.Reason)
+}
+
+// ErrWebSocketClosed is returned when using a closed WebSocketConn.
+var ErrWebSocketClosed = errors.New("way: websocket connection closed")
+
+// WebSocketOptions configures a WebSocket route.
+type WebSocketOptions struct {
+	// Origins are the origins allowed to connect from browsers, such as
+	// "https://example.com", or "*" for any. By default only the origin
+	// with the host of the request is allowed. Requests without an
+	// Origin header, from clients other than browsers, are allowed.
+	Origins []string
+	// Subprotocols supported, in order of preference.
+	Subprotocols []string
+	// MaxMessageSize in bytes of messages read. By default 1 MiB.
+	MaxMessageSize int64
+}
+
+// WebSocket adds a GET route upgrading requests to WebSocket
+// connections (RFC 6455) handled by handler. The connection is closed
+// when handler returns. Requests that are not valid handshakes get
+// 400 Bad Request, or 426 Upgrade Required for other protocol
+// versions, and disallowed origins get 403 Forbidden.
+func (rtr *Router) WebSocket(pattern string, handler func(*WebSocketConn), opts WebSocketOptions, routeOpts ...RouteOption) {
+	if opts.MaxMessageSize <= 0 {
+		opts.MaxMessageSize = 1 << 20
+	}
+	rtr.Handle(WAY_GET, pattern, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, p := opts.upgrade(w, r)
+		if p != nil {
+			RenderError(w, r, p)
+			return
+		}
+		if c == nil {
+			// the handshake response could not be written
+			return
+		}
+		defer c.Close(CloseNormal, "")
+		handler(c)
+	}), routeOpts...)
+}
+
+// upgrade performs the handshake, taking over the connection of w.
+// Returns a nil connection and Problem if the connection broke.
+func (opts *WebSocketOptions) upgrade(w http.ResponseWriter, r *http.Request) (*WebSocketConn, *Problem) {
+	if !headerHasToken(r.Header, "Connection", "upgrade") || !headerHasToken(r.Header, "Upgrade", "websocket") {
+		return nil, NewProblem(http.StatusBadRequest, "Not a WebSocket handshake.")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		return nil, NewProblem(http.StatusUpgradeRequired, "Unsupported WebSocket version.")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if b, err := base64.StdEncoding.DecodeString(key); err != nil || len(b) != 16 {
+		return nil, NewProblem(http.StatusBadRequest, "Invalid Sec-WebSocket-Key.")
+	}
+	if !opts.allowOrigin(r) {
+		return nil, NewProblem(http.StatusForbidden, "Origin not allowed.")
+	}
+	var subprotocol string
+	offered := splitList(r.Header.Values("Sec-WebSocket-Protocol"))
+	for _, p := range opts.Subprotocols {
+		if slices.Contains(offered, p) {
+			subprotocol = p
+			break
+		}
+	}
+
+	conn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return nil, NewProblem(http.StatusInternalServerError, "")
+	}
+	// not every Hijacker clears the deadlines of the server's ReadTimeout
+	// and WriteTimeout, meant for requests, not connections staying open
+	conn.SetDeadline(time.Time{})
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	h := w.Header().Clone()
+	h.Set("Upgrade", "websocket")
+	h.Set("Connection", "Upgrade")
+	h.Set("Sec-WebSocket-Accept", base64.StdEncoding.EncodeToString(sum[:]))
+	if subprotocol != "" {
+		h.Set("Sec-WebSocket-Protocol", subprotocol)
+	}
+	bw := bufio.NewWriter(conn)
+	bw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	h.Write(bw)
+	bw.WriteString("\r\n")
+	if err := bw.Flush(); err != nil {
+		conn.Close()
+		return nil, nil
+	}
+	return &WebSocketConn{
+		conn:        conn,
+		br:          brw.Reader,
+		r:           r,
+		subprotocol: subprotocol,
+		maxSize:     opts.MaxMessageSize,
+	}, nil
+}
+
+// allowOrigin checks the Origin header of a handshake.
+func (opts *WebSocketOptions) allowOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if opts.Origins == nil {
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, r.Host)
+	}
+	return slices.ContainsFunc(opts.Origins, func(o string) bool {
+		return o == "*" || strings.EqualFold(o, origin)
+	})
+}
+
+// headerHasToken reports whether the comma separated values of
+// the header contain token, case-insensitively.
+func headerHasToken(h http.Header, name, token string) bool {
+	return slices.ContainsFunc(splitList(h.Values(name)), func(v string) bool {
+		return strings.EqualFold(v, token)
+	})
+}
+
+// WebSocketConn is a WebSocket connection, read and written one whole
+// message at a time. ReadMessage must not be called concurrently,
+// the other methods can.
+type WebSocketConn struct {
+	conn        net.Conn
+	br          *bufio.Reader
+	r           *http.Request
+	subprotocol string
+	maxSize     int64
+
+	mu     sync.Mutex // guards writes and closed
+	closed bool
+}
+
+// Request returns the handshake request, whose Context carries the
+// path parameters of the route for Param.
+func (c *WebSocketConn) Request() *http.Request {
+	return c.r
+}
+
+// Subprotocol returns the negotiated subprotocol, or "" if none.
+func (c *WebSocketConn) Subprotocol() string {
+	return c.subprotocol
+}
+
+// ReadMessage reads the next data message, answering pings and
+// reassembling fragments. Returns a *CloseError when the connection
+// is closed with a close frame.
+func (c *WebSocketConn) ReadMessage() (MessageType, []byte, error) {
+	var typ MessageType
+	var msg []byte
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			var ce *CloseError
+			if errors.As(err, &ce) {
+				c.Close(ce.Code, ce.Reason)
+			} else {
+				c.closeConn()
+			}
+			return 0, nil, err
+		}
+		switch op {
+		case 0x8: // close
+			ce := &CloseError{Code: CloseNoStatus}
+			if len(payload) >= 2 {
+				ce.Code = int(binary.BigEndian.Uint16(payload))
+				ce.Reason = string(payload[2:])
+			}
+			switch {
+			case len(payload) == 1 || len(payload) >= 2 && !validCloseCode(ce.Code):
+				return 0, nil, c.fail(CloseProtocolError, "invalid close code")
+			case !utf8.ValidString(ce.Reason):
+				return 0, nil, c.fail(CloseInvalidPayload, "invalid UTF-8")
+			}
+			c.Close(ce.Code, "")
+			return 0, nil, ce
+		case 0x9: // ping
+			if err := c.writeFrame(0xA, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case 0xA: // pong
+			continue
+		case 0x0:
+			if typ == 0 {
+				return 0, nil, c.fail(CloseProtocolError, "unexpected continuation frame")
+			}
+		case 0x1, 0x2:
+			if typ != 0 {
+				return 0, nil, c.fail(CloseProtocolError, "expected continuation frame")
+			}
+			typ = MessageType(op)
+		default:
+			return 0, nil, c.fail(CloseProtocolError, "unknown opcode")
+		}
+		if int64(len(msg)+len(payload)) > c.maxSize {
+			return 0, nil, c.fail(CloseMessageTooBig, "message too big")
+		}
+		msg = append(msg, payload...)
+		if fin {
+			if typ == TextMessage && !utf8.Valid(msg) {
+				return 0, nil, c.fail(CloseInvalidPayload, "invalid UTF-8")
+			}
+			return typ, msg, nil
+		}
+	}
+}
+
+// validCloseCode reports whether a peer may send code in a close
+// frame: a defined code or one for libraries and applications, not
+// 1005 and 1006, which are reserved for when there is no close frame.
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1014:
+		return true
+	}
+	return code >= 3000 && code <= 4999
+}
+
+// readFrame reads a frame from the client, unmasking its payload.
+func (c *WebSocketConn) readFrame() (fin bool, op byte, payload []byte, err error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(c.br, hdr[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin, op = hdr[0]&0x80 != 0, hdr[0]&0x0f
+	if hdr[0]&0x70 != 0 {
+		return false, 0, nil, &CloseError{CloseProtocolError, "reserved bits set"}
+	}
+	if hdr[1]&0x80 == 0 {
+		return false, 0, nil, &CloseError{CloseProtocolError, "unmasked client frame"}
+	}
+	n := uint64(hdr[1] & 0x7f)
+	if op >= 0x8 && (!fin || n > 125) {
+		return false, 0, nil, &CloseError{CloseProtocolError, "invalid control frame"}
+	}
+	switch n {
+	case 126:
+		var b [2]byte
+		if _, err := io.ReadFull(c.br, b[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		if _, err := io.ReadFull(c.br, b[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(b[:])
+	}
+	if n > uint64(c.maxSize) {
+		return false, 0, nil, &CloseError{CloseMessageTooBig, "message too big"}
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload = make([]byte, n)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, op, payload, nil
+}
+
+// WriteMessage writes a data message in a single frame.
+func (c *WebSocketConn) WriteMessage(typ MessageType, data []byte) error {
+	if typ != TextMessage && typ != BinaryMessage {
+		return fmt.Errorf("way: invalid websocket message type %d", typ)
+	}
+	return c.writeFrame(byte(typ), data)
+}
+
+// writeFrame writes an unmasked final frame, as servers do.
+func (c *WebSocketConn) writeFrame(op byte, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return ErrWebSocketClosed
+	}
+	hdr := make([]byte, 2, 10+len(payload))
+	hdr[0] = 0x80 | op
+	switch n := len(payload); {
+	case n <= 125:
+		hdr[1] = byte(n)
+	case n <= 0xffff:
+		hdr[1] = 126
+		hdr = binary.BigEndian.AppendUint16(hdr, uint16(n))
+	default:
+		hdr[1] = 127
+		hdr = binary.BigEndian.AppendUint64(hdr, uint64(n))
+	}
+	_, err := c.conn.Write(append(hdr, payload...))
+	return err
+}
+
+// maxCloseReason is the longest reason fitting in a close frame,
+// whose payload is at most 125 bytes including the 2 of the code.
+const maxCloseReason = 123
+
+// fail closes the connection because of an invalid message.
+func (c *WebSocketConn) fail(code int, reason string) error {
+	c.Close(code, reason)
+	return &CloseError{Code: code, Reason: reason}
+}
+
+// Close sends a close frame with the code and reason, then closes the
+// connection. Reasons over the 123 bytes a close frame has room for
+// are truncated, keeping whole UTF-8 characters. Closing a closed
+// connection does nothing.
+func (c *WebSocketConn) Close(code int, reason string) error {
+	var payload []byte
+	if code != CloseNoStatus {
+		if len(reason) > maxCloseReason {
+			n := maxCloseReason
+			for n > 0 && !utf8.RuneStart(reason[n]) {
+				n--
+			}
+			reason = reason[:n]
+		}
+		payload = binary.BigEndian.AppendUint16(nil, uint16(code))
+		payload = append(payload, reason...)
+	}
+	err := c.writeFrame(0x8, payload)
+	if err == ErrWebSocketClosed {
+		return nil
+	}
+	c.closeConn()
+	return err
+}
+
+// closeConn closes the network connection without a close frame.
+func (c *WebSocketConn) closeConn() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.closed = true
+		c.conn.Close()
+	}
+}
@@ -0,0 +1,271 @@
+package way
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// wsClient is the client end of a WebSocket connection in tests.
+type wsClient struct {
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+// dialWebSocket performs the handshake with the server at url, with
+// the extra request headers, returning the handshake response.
+func dialWebSocket(t *testing.T, url string, headers map[string]string) (*wsClient, *http.Response) {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	h := map[string]string{
+		"Connection":            "Upgrade",
+		"Upgrade":               "websocket",
+		"Sec-WebSocket-Version": "13",
+		"Sec-WebSocket-Key":     "dGhlIHNhbXBsZSBub25jZQ==",
+	}
+	maps.Copy(h, headers)
+	req := "GET /ws/lobby HTTP/1.1\r\nHost: " + strings.TrimPrefix(url, "http://") + "\r\n"
+	for k, v := range h {
+		req += k + ": " + v + "\r\n"
+	}
+	if _, err := io.WriteString(conn, req+"\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	c := &wsClient{conn: conn, br: bufio.NewReader(conn)}
+	resp, err := http.ReadResponse(c.br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, resp
+}
+
+// writeFrame writes a masked frame, as clients do.
+func (c *wsClient) writeFrame(t *testing.T, fin bool, op byte, payload []byte) {
+	t.Helper()
+	b0 := op
+	if fin {
+		b0 |= 0x80
+	}
+	mask := [4]byte{1, 2, 3, 4}
+	frame := []byte{b0, 0x80 | byte(len(payload))}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	if _, err := c.conn.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readFrame reads an unmasked frame of at most 125 bytes.
+func (c *wsClient) readFrame(t *testing.T) (op byte, payload []byte) {
+	t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var hdr [2]byte
+	if _, err := io.ReadFull(c.br, hdr[:]); err != nil {
+		t.Fatal(err)
+	}
+	payload = make([]byte, hdr[1]&0x7f)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		t.Fatal(err)
+	}
+	return hdr[0] & 0x0f, payload
+}
+
+// closePayload makes the payload of a close frame.
+func closePayload(code int, reason string) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, uint16(code)), reason...)
+}
+
+// newWebSocketServer serves an echo WebSocket route prefixing messages
+// with the room parameter, with short server timeouts.
+func newWebSocketServer(t *testing.T, opts WebSocketOptions) *httptest.Server {
+	rtr := NewRouter()
+	rtr.WebSocket("/ws/:room", func(c *WebSocketConn) {
+		room := Param(c.Request().Context(), "room")
+		for {
+			typ, msg, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			c.WriteMessage(typ, append([]byte(room+": "), msg...))
+		}
+	}, opts)
+	srv := httptest.NewUnstartedServer(rtr)
+	srv.Config.ReadTimeout = 50 * time.Millisecond
+	srv.Config.WriteTimeout = 50 * time.Millisecond
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestWebSocketHandshake(t *testing.T) {
+	srv := newWebSocketServer(t, WebSocketOptions{Origins: []string{"https://example.com"}, Subprotocols: []string{"chat.v2", "chat.v1"}})
+
+	tests := []struct {
+		name        string
+		headers     map[string]string
+		status      int
+		subprotocol string
+	}{
+		{name: "no origin", status: http.StatusSwitchingProtocols},
+		{name: "allowed origin", headers: map[string]string{"Origin": "https://example.com"}, status: http.StatusSwitchingProtocols},
+		{name: "other origin", headers: map[string]string{"Origin": "https://evil.example"}, status: http.StatusForbidden},
+		{name: "subprotocol", headers: map[string]string{"Sec-WebSocket-Protocol": "chat.v1, chat.v2"}, status: http.StatusSwitchingProtocols, subprotocol: "chat.v2"},
+		{name: "unknown subprotocol", headers: map[string]string{"Sec-WebSocket-Protocol": "chat.v3"}, status: http.StatusSwitchingProtocols},
+		{name: "old version", headers: map[string]string{"Sec-WebSocket-Version": "8"}, status: http.StatusUpgradeRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, resp := dialWebSocket(t, srv.URL, tt.headers)
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+			if tt.status != http.StatusSwitchingProtocols {
+				return
+			}
+			if got := resp.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+				t.Errorf("Sec-WebSocket-Accept = %q", got)
+			}
+			if got := resp.Header.Get("Sec-WebSocket-Protocol"); got != tt.subprotocol {
+				t.Errorf("Sec-WebSocket-Protocol = %q, want %q", got, tt.subprotocol)
+			}
+		})
+	}
+
+	t.Run("not an upgrade", func(t *testing.T) {
+		resp, err := http.Get(srv.URL + "/ws/lobby")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("status = %d, want 400", resp.StatusCode)
+		}
+	})
+}
+
+func TestWebSocketMessages(t *testing.T) {
+	srv := newWebSocketServer(t, WebSocketOptions{MaxMessageSize: 16})
+	c, resp := dialWebSocket(t, srv.URL, nil)
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status = %d, want 101", resp.StatusCode)
+	}
+
+	// outlive the server's timeouts
+	time.Sleep(100 * time.Millisecond)
+	c.writeFrame(t, true, 0x1, []byte("hello"))
+	if op, msg := c.readFrame(t); op != 0x1 || string(msg) != "lobby: hello" {
+		t.Fatalf("got %d %q, want text %q", op, msg, "lobby: hello")
+	}
+
+	c.writeFrame(t, false, 0x2, []byte("he"))
+	c.writeFrame(t, true, 0x9, []byte("ping"))
+	if op, msg := c.readFrame(t); op != 0xA || string(msg) != "ping" {
+		t.Fatalf("got %d %q, want pong %q", op, msg, "ping")
+	}
+	c.writeFrame(t, true, 0x0, []byte("llo"))
+	if op, msg := c.readFrame(t); op != 0x2 || string(msg) != "lobby: hello" {
+		t.Fatalf("got %d %q, want binary %q", op, msg, "lobby: hello")
+	}
+
+	c.writeFrame(t, true, 0x1, []byte("far too long a message"))
+	if op, msg := c.readFrame(t); op != 0x8 || binary.BigEndian.Uint16(msg) != CloseMessageTooBig {
+		t.Fatalf("got %d %q, want close %d", op, msg, CloseMessageTooBig)
+	}
+}
+
+func TestWebSocketClose(t *testing.T) {
+	srv := newWebSocketServer(t, WebSocketOptions{})
+
+	tests := []struct {
+		name    string
+		op      byte
+		payload []byte
+		// want is the code of the close frame replied, or -1 for none
+		want int
+	}{
+		{name: "normal", op: 0x8, payload: closePayload(CloseNormal, "bye"), want: CloseNormal},
+		{name: "application code", op: 0x8, payload: closePayload(4000, ""), want: 4000},
+		{name: "no status", op: 0x8, want: -1},
+		{name: "1005", op: 0x8, payload: closePayload(CloseNoStatus, ""), want: CloseProtocolError},
+		{name: "1006", op: 0x8, payload: closePayload(1006, ""), want: CloseProtocolError},
+		{name: "1015", op: 0x8, payload: closePayload(1015, ""), want: CloseProtocolError},
+		{name: "below 1000", op: 0x8, payload: closePayload(999, ""), want: CloseProtocolError},
+		{name: "5000", op: 0x8, payload: closePayload(5000, ""), want: CloseProtocolError},
+		{name: "one byte", op: 0x8, payload: []byte{3}, want: CloseProtocolError},
+		{name: "invalid reason", op: 0x8, payload: closePayload(CloseNormal, "\xff"), want: CloseInvalidPayload},
+		{name: "invalid text", op: 0x1, payload: []byte("\xff"), want: CloseInvalidPayload},
+		{name: "unknown opcode", op: 0x3, want: CloseProtocolError},
+		{name: "continuation", op: 0x0, payload: []byte("x"), want: CloseProtocolError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := dialWebSocket(t, srv.URL, nil)
+			c.writeFrame(t, true, tt.op, tt.payload)
+			op, msg := c.readFrame(t)
+			if op != 0x8 {
+				t.Fatalf("opcode = %d, want close", op)
+			}
+			if tt.want == -1 {
+				if len(msg) != 0 {
+					t.Errorf("close payload = %q, want none", msg)
+				}
+				return
+			}
+			if len(msg) < 2 || int(binary.BigEndian.Uint16(msg)) != tt.want {
+				t.Errorf("close payload = %q, want code %d", msg, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebSocketCloseReason(t *testing.T) {
+	tests := []struct {
+		name   string
+		reason string
+		want   string
+	}{
+		{name: "short", reason: "bye", want: "bye"},
+		{name: "at limit", reason: strings.Repeat("a", 123), want: strings.Repeat("a", 123)},
+		{name: "over limit", reason: strings.Repeat("a", 200), want: strings.Repeat("a", 123)},
+		// the 62nd "é" would take bytes 123 and 124
+		{name: "two-byte characters", reason: strings.Repeat("é", 100), want: strings.Repeat("é", 61)},
+		{name: "boundary at limit", reason: "a" + strings.Repeat("é", 100), want: "a" + strings.Repeat("é", 61)},
+		{name: "three-byte characters", reason: strings.Repeat("€", 50), want: strings.Repeat("€", 41)},
+		{name: "four-byte characters", reason: strings.Repeat("🎸", 40), want: strings.Repeat("🎸", 30)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rtr := NewRouter()
+			rtr.WebSocket("/ws/:room", func(c *WebSocketConn) {
+				c.Close(CloseGoingAway, tt.reason)
+			}, WebSocketOptions{})
+			srv := httptest.NewServer(rtr)
+			defer srv.Close()
+
+			c, _ := dialWebSocket(t, srv.URL, nil)
+			op, msg := c.readFrame(t)
+			if op != 0x8 {
+				t.Fatalf("opcode = %d, want close", op)
+			}
+			if len(msg) < 2 || int(binary.BigEndian.Uint16(msg)) != CloseGoingAway {
+				t.Fatalf("close payload = %q, want code %d", msg, CloseGoingAway)
+			}
+			if got := string(msg[2:]); got != tt.want {
+				t.Errorf("reason = %q (%d bytes), want %q", got, len(got), tt.want)
+			}
+		})
+	}
+}
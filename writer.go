@@ -0,0 +1,143 @@
+package way
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+)
+
+// StatusWriter wraps an http.ResponseWriter recording the status
+// code and the number of body bytes written, for middleware such as
+// logging and metrics. Use WrapWriter to make one.
+type StatusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+// WrapWriter wraps w in a StatusWriter. The returned
+// http.ResponseWriter implements http.Flusher, http.Hijacker and
+// io.ReaderFrom exactly when w does.
+func WrapWriter(w http.ResponseWriter) (http.ResponseWriter, *StatusWriter) {
+	sw := &StatusWriter{ResponseWriter: w}
+	_, fl := w.(http.Flusher)
+	_, hj := w.(http.Hijacker)
+	_, rf := w.(io.ReaderFrom)
+
+	switch {
+	case fl && hj && rf:
+		return struct {
+			*StatusWriter
+			http.Flusher
+			http.Hijacker
+			io.ReaderFrom
+		}{sw, flushFunc(sw.flush), hijackFunc(sw.hijack), readFromFunc(sw.readFrom)}, sw
+	case fl && hj:
+		return struct {
+			*StatusWriter
+			http.Flusher
+			http.Hijacker
+		}{sw, flushFunc(sw.flush), hijackFunc(sw.hijack)}, sw
+	case fl && rf:
+		return struct {
+			*StatusWriter
+			http.Flusher
+			io.ReaderFrom
+		}{sw, flushFunc(sw.flush), readFromFunc(sw.readFrom)}, sw
+	case hj && rf:
+		return struct {
+			*StatusWriter
+			http.Hijacker
+			io.ReaderFrom
+		}{sw, hijackFunc(sw.hijack), readFromFunc(sw.readFrom)}, sw
+	case fl:
+		return struct {
+			*StatusWriter
+			http.Flusher
+		}{sw, flushFunc(sw.flush)}, sw
+	case hj:
+		return struct {
+			*StatusWriter
+			http.Hijacker
+		}{sw, hijackFunc(sw.hijack)}, sw
+	case rf:
+		return struct {
+			*StatusWriter
+			io.ReaderFrom
+		}{sw, readFromFunc(sw.readFrom)}, sw
+	}
+	return sw, sw
+}
+
+// Status returns the status code sent to the client. A handler
+// that returns without writing anything implicitly sends 200.
+func (sw *StatusWriter) Status() int {
+	if sw.status == 0 {
+		return http.StatusOK
+	}
+	return sw.status
+}
+
+// BytesWritten returns the number of body bytes written.
+func (sw *StatusWriter) BytesWritten() int64 {
+	return sw.bytes
+}
+
+func (sw *StatusWriter) WriteHeader(code int) {
+	if sw.status == 0 && code >= http.StatusOK {
+		sw.status = code
+	}
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+func (sw *StatusWriter) Write(b []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	n, err := sw.ResponseWriter.Write(b)
+	sw.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap returns the wrapped http.ResponseWriter
+// for use by http.ResponseController.
+func (sw *StatusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+func (sw *StatusWriter) flush() {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	sw.ResponseWriter.(http.Flusher).Flush()
+}
+
+func (sw *StatusWriter) hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := sw.ResponseWriter.(http.Hijacker).Hijack()
+	if err == nil && sw.status == 0 {
+		sw.status = http.StatusSwitchingProtocols
+	}
+	return conn, brw, err
+}
+
+func (sw *StatusWriter) readFrom(src io.Reader) (int64, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	n, err := sw.ResponseWriter.(io.ReaderFrom).ReadFrom(src)
+	sw.bytes += n
+	return n, err
+}
+
+type flushFunc func()
+
+func (f flushFunc) Flush() { f() }
+
+type hijackFunc func() (net.Conn, *bufio.ReadWriter, error)
+
+func (f hijackFunc) Hijack() (net.Conn, *bufio.ReadWriter, error) { return f() }
+
+type readFromFunc func(io.Reader) (int64, error)
+
+func (f readFromFunc) ReadFrom(src io.Reader) (int64, error) { return f(src) }
@@ -0,0 +1,172 @@
+package way
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// optionalWriter records the calls to the optional
+// interfaces of http.ResponseWriter.
+type optionalWriter struct {
+	*httptest.ResponseRecorder
+	flushed, hijacked, readFrom bool
+}
+
+func (o *optionalWriter) Flush() { o.flushed = true }
+
+func (o *optionalWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	o.hijacked = true
+	return nil, nil, nil
+}
+
+func (o *optionalWriter) ReadFrom(src io.Reader) (int64, error) {
+	o.readFrom = true
+	return io.Copy(o.ResponseRecorder.Body, src)
+}
+
+// writerWith exposes the interfaces of o that are asked for.
+func writerWith(o *optionalWriter, fl, hj, rf bool) http.ResponseWriter {
+	type writer struct{ http.ResponseWriter }
+	w := writer{o}
+	switch {
+	case fl && hj && rf:
+		return struct {
+			writer
+			http.Flusher
+			http.Hijacker
+			io.ReaderFrom
+		}{w, o, o, o}
+	case fl && hj:
+		return struct {
+			writer
+			http.Flusher
+			http.Hijacker
+		}{w, o, o}
+	case fl && rf:
+		return struct {
+			writer
+			http.Flusher
+			io.ReaderFrom
+		}{w, o, o}
+	case hj && rf:
+		return struct {
+			writer
+			http.Hijacker
+			io.ReaderFrom
+		}{w, o, o}
+	case fl:
+		return struct {
+			writer
+			http.Flusher
+		}{w, o}
+	case hj:
+		return struct {
+			writer
+			http.Hijacker
+		}{w, o}
+	case rf:
+		return struct {
+			writer
+			io.ReaderFrom
+		}{w, o}
+	}
+	return w
+}
+
+func optionalNames(fl, hj, rf bool) []string {
+	var names []string
+	if fl {
+		names = append(names, "Flusher")
+	}
+	if hj {
+		names = append(names, "Hijacker")
+	}
+	if rf {
+		names = append(names, "ReaderFrom")
+	}
+	return names
+}
+
+func TestWrapWriter(t *testing.T) {
+	for i := range 8 {
+		fl, hj, rf := i&1 != 0, i&2 != 0, i&4 != 0
+		name := "none"
+		if names := optionalNames(fl, hj, rf); len(names) > 0 {
+			name = strings.Join(names, "+")
+		}
+		t.Run(name, func(t *testing.T) {
+			o := &optionalWriter{ResponseRecorder: httptest.NewRecorder()}
+			ww, sw := WrapWriter(writerWith(o, fl, hj, rf))
+
+			f, gotFl := ww.(http.Flusher)
+			h, gotHj := ww.(http.Hijacker)
+			r, gotRf := ww.(io.ReaderFrom)
+			if gotFl != fl || gotHj != hj || gotRf != rf {
+				t.Fatalf("Flusher %v, Hijacker %v, ReaderFrom %v; want %v, %v, %v", gotFl, gotHj, gotRf, fl, hj, rf)
+			}
+			if u, ok := ww.(interface{ Unwrap() http.ResponseWriter }); !ok || u.Unwrap() == nil {
+				t.Error("the writer cannot be unwrapped")
+			}
+
+			want := http.StatusOK
+			if hj {
+				h.Hijack()
+				want = http.StatusSwitchingProtocols
+			}
+			if fl {
+				f.Flush()
+			}
+			if rf {
+				r.ReadFrom(strings.NewReader("song"))
+			}
+			ww.Write([]byte("!"))
+			if o.flushed != fl || o.hijacked != hj || o.readFrom != rf {
+				t.Errorf("calls reached: Flush %v, Hijack %v, ReadFrom %v", o.flushed, o.hijacked, o.readFrom)
+			}
+			if sw.Status() != want {
+				t.Errorf("Status = %d, want %d", sw.Status(), want)
+			}
+			if n := int64(o.Body.Len()); sw.BytesWritten() != n {
+				t.Errorf("BytesWritten = %d, want %d", sw.BytesWritten(), n)
+			}
+		})
+	}
+}
+
+func TestStatusWriter(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		status  int
+		bytes   int64
+	}{
+		{name: "nothing written", handler: func(w http.ResponseWriter, r *http.Request) {}, status: http.StatusOK},
+		{name: "implicit status", handler: func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "song")
+		}, status: http.StatusOK, bytes: 4},
+		{name: "explicit status", handler: func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+			w.WriteHeader(http.StatusAccepted)
+			io.WriteString(w, "a")
+			io.WriteString(w, "bc")
+		}, status: http.StatusCreated, bytes: 3},
+		{name: "informational status", handler: func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusEarlyHints)
+			w.WriteHeader(http.StatusNotFound)
+		}, status: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ww, sw := WrapWriter(httptest.NewRecorder())
+			tt.handler(ww, httptest.NewRequest(http.MethodGet, "/", nil))
+			if sw.Status() != tt.status || sw.BytesWritten() != tt.bytes {
+				t.Errorf("Status = %d, BytesWritten = %d; want %d, %d", sw.Status(), sw.BytesWritten(), tt.status, tt.bytes)
+			}
+		})
+	}
+}
@@ -0,0 +1,473 @@
+package way
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseYAML decodes the subset of YAML that OpenAPI documents use into
+// the values encoding/json would give for the same document: block and
+// flow mappings and sequences, plain and quoted scalars, literal and
+// folded block scalars, and comments. Anchors, aliases, tags and
+// multiple documents are not supported.
+func parseYAML(data []byte) (any, error) {
+	p := &yamlParser{lines: strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")}
+	for p.n = range p.lines {
+		line := p.lines[p.n]
+		if ws := line[:len(line)-len(strings.TrimLeft(line, " \t"))]; strings.Contains(ws, "\t") && strings.TrimSpace(line) != "" {
+			return nil, p.errorf("tabs are not allowed in indentation")
+		}
+	}
+	p.n = 0
+	if p.skip() && strings.TrimSpace(p.lines[p.n]) == "---" {
+		p.n++
+	}
+	if !p.skip() {
+		return nil, nil
+	}
+	v, err := p.node(p.indent())
+	if err != nil {
+		return nil, err
+	}
+	if p.skip() && strings.TrimSpace(p.lines[p.n]) != "..." {
+		return nil, p.errorf("unexpected content")
+	}
+	return v, nil
+}
+
+type yamlParser struct {
+	lines []string
+	n     int // index of the current line
+}
+
+func (p *yamlParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("line %d: %s", p.n+1, fmt.Sprintf(format, args...))
+}
+
+// skip moves to the next line with content, reporting whether
+// there is one.
+func (p *yamlParser) skip() bool {
+	for ; p.n < len(p.lines); p.n++ {
+		s := strings.TrimSpace(p.lines[p.n])
+		if s != "" && !strings.HasPrefix(s, "#") {
+			return true
+		}
+	}
+	return false
+}
+
+// indent returns the indentation of the current line.
+func (p *yamlParser) indent() int {
+	line := p.lines[p.n]
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// content returns the current line without indentation and comment.
+func (p *yamlParser) content() string {
+	return stripYAMLComment(strings.TrimLeft(p.lines[p.n], " "))
+}
+
+// node parses the value starting on the current line, indented by indent.
+func (p *yamlParser) node(indent int) (any, error) {
+	if isYAMLItem(p.content()) {
+		return p.sequence(indent)
+	}
+	if _, _, ok := splitYAMLKey(p.content()); ok {
+		return p.mapping(indent)
+	}
+	v, err := parseYAMLInline(p.content())
+	if err != nil {
+		return nil, p.errorf("%v", err)
+	}
+	p.n++
+	return v, nil
+}
+
+func (p *yamlParser) mapping(indent int) (map[string]any, error) {
+	m := map[string]any{}
+	for p.skip() && p.indent() == indent && !isYAMLItem(p.content()) {
+		if p.content() == "---" {
+			return nil, p.errorf("multiple documents are not supported")
+		}
+		key, rest, ok := splitYAMLKey(p.content())
+		if !ok {
+			return nil, p.errorf("expected a mapping key")
+		}
+		if _, dup := m[key]; dup {
+			return nil, p.errorf("duplicate key %q", key)
+		}
+		v, err := p.value(indent, rest, true)
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+	}
+	if p.skip() && p.indent() > indent {
+		return nil, p.errorf("unexpected indentation")
+	}
+	return m, nil
+}
+
+func (p *yamlParser) sequence(indent int) ([]any, error) {
+	list := []any{}
+	for p.skip() && p.indent() == indent && isYAMLItem(p.content()) {
+		line := p.lines[p.n]
+		item := strings.TrimLeft(line[indent+1:], " ")
+		if c := stripYAMLComment(item); c != "" && !strings.HasPrefix(c, "|") && !strings.HasPrefix(c, ">") {
+			if _, _, ok := splitYAMLKey(c); ok || isYAMLItem(c) {
+				// parse the item as if it started on its own line
+				p.lines[p.n] = strings.Repeat(" ", len(line)-len(item)) + item
+				v, err := p.node(len(line) - len(item))
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, v)
+				continue
+			}
+		}
+		v, err := p.value(indent, stripYAMLComment(item), false)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+	if p.skip() && p.indent() > indent {
+		return nil, p.errorf("unexpected indentation")
+	}
+	return list, nil
+}
+
+// value parses the value rest following a key or item on the
+// current line, which may continue on the lines indented further.
+// A mapping value may be a sequence indented as much as its key.
+func (p *yamlParser) value(indent int, rest string, inMapping bool) (any, error) {
+	if strings.HasPrefix(rest, "|") || strings.HasPrefix(rest, ">") {
+		return p.blockScalar(indent, rest)
+	}
+	if rest != "" {
+		v, err := parseYAMLInline(rest)
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		p.n++
+		return v, nil
+	}
+	p.n++
+	if !p.skip() {
+		return nil, nil
+	}
+	switch next := p.indent(); {
+	case next > indent:
+		return p.node(next)
+	case next == indent && inMapping && isYAMLItem(p.content()):
+		return p.sequence(indent)
+	}
+	return nil, nil
+}
+
+// blockScalar parses a literal (|) or folded (>) block scalar with
+// the specified header, whose lines are indented more than indent.
+func (p *yamlParser) blockScalar(indent int, header string) (string, error) {
+	chomp := header[1:]
+	if chomp != "" && chomp != "-" && chomp != "+" {
+		return "", p.errorf("unsupported block scalar header %q", header)
+	}
+	p.n++
+	var lines []string
+	block := -1
+	for ; p.n < len(p.lines); p.n++ {
+		line := p.lines[p.n]
+		if strings.TrimSpace(line) == "" {
+			lines = append(lines, "")
+			continue
+		}
+		n := len(line) - len(strings.TrimLeft(line, " "))
+		if block < 0 {
+			block = n
+		}
+		if n <= indent || n < block {
+			break
+		}
+		lines = append(lines, line[block:])
+	}
+	// trailing blank lines only matter to keep chomping
+	end := len(lines)
+	for end > 0 && lines[end-1] == "" {
+		end--
+	}
+	trailing := len(lines) - end
+	lines = lines[:end]
+
+	var s string
+	if header[0] == '|' {
+		s = strings.Join(lines, "\n")
+	} else {
+		// single line breaks fold into spaces, blank lines into line breaks
+		var b strings.Builder
+		for i, line := range lines {
+			if line == "" {
+				b.WriteString("\n")
+			} else if i > 0 && lines[i-1] != "" {
+				b.WriteString(" ")
+			}
+			b.WriteString(line)
+		}
+		s = b.String()
+	}
+	switch {
+	case len(lines) == 0 || chomp == "-":
+	case chomp == "+":
+		s += strings.Repeat("\n", trailing+1)
+	default:
+		s += "\n"
+	}
+	return s, nil
+}
+
+// isYAMLItem reports whether s is a block sequence item.
+func isYAMLItem(s string) bool {
+	return s == "-" || strings.HasPrefix(s, "- ")
+}
+
+// splitYAMLKey splits a "key: value" mapping entry.
+func splitYAMLKey(s string) (key, rest string, ok bool) {
+	if s == "" {
+		return "", "", false
+	}
+	if s[0] == '"' || s[0] == '\'' {
+		k, n, err := parseYAMLQuoted(s)
+		if err != nil {
+			return "", "", false
+		}
+		rest = strings.TrimLeft(s[n:], " ")
+		if !strings.HasPrefix(rest, ":") || len(rest) > 1 && rest[1] != ' ' {
+			return "", "", false
+		}
+		return k, strings.TrimSpace(rest[1:]), true
+	}
+	if strings.ContainsRune("[{&*!|>", rune(s[0])) {
+		return "", "", false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] == ':' && (i+1 == len(s) || s[i+1] == ' ') {
+			return strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+// stripYAMLComment removes a trailing comment from s.
+func stripYAMLComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' || c == '\'' && quote == '\'' && i+1 < len(s) && s[i+1] == '\'' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			if i == 0 || strings.ContainsRune(" [{,:", rune(s[i-1])) {
+				quote = c
+			}
+		case c == '#' && (i == 0 || s[i-1] == ' '):
+			return strings.TrimRight(s[:i], " ")
+		}
+	}
+	return strings.TrimRight(s, " ")
+}
+
+// parseYAMLInline parses a scalar or flow collection taking up s.
+func parseYAMLInline(s string) (any, error) {
+	f := &yamlFlow{s: s}
+	v, err := f.value()
+	if err != nil {
+		return nil, err
+	}
+	if f.space(); f.i < len(f.s) {
+		return nil, fmt.Errorf("unexpected %q", f.s[f.i:])
+	}
+	return v, nil
+}
+
+// yamlFlow parses flow style values, e.g. [a, b] or {a: 1}.
+type yamlFlow struct {
+	s     string
+	i     int
+	depth int // of nested flow collections
+}
+
+func (f *yamlFlow) space() {
+	for f.i < len(f.s) && f.s[f.i] == ' ' {
+		f.i++
+	}
+}
+
+func (f *yamlFlow) value() (any, error) {
+	f.space()
+	if f.i == len(f.s) {
+		return nil, nil
+	}
+	switch c := f.s[f.i]; c {
+	case '[':
+		return f.sequence()
+	case '{':
+		return f.mapping()
+	case '"', '\'':
+		s, n, err := parseYAMLQuoted(f.s[f.i:])
+		f.i += n
+		return s, err
+	case '&', '*', '!':
+		return nil, errors.New("anchors, aliases and tags are not supported")
+	}
+	return resolveYAMLScalar(f.plain()), nil
+}
+
+// plain scans a plain scalar, which in a flow collection
+// ends before an indicator.
+func (f *yamlFlow) plain() string {
+	start := f.i
+	for ; f.i < len(f.s); f.i++ {
+		c := f.s[f.i]
+		if f.depth > 0 && strings.IndexByte(",[]{}", c) >= 0 {
+			break
+		}
+		if f.depth > 0 && c == ':' && (f.i+1 == len(f.s) || strings.IndexByte(" ,]}", f.s[f.i+1]) >= 0) {
+			break
+		}
+	}
+	return strings.TrimSpace(f.s[start:f.i])
+}
+
+func (f *yamlFlow) sequence() ([]any, error) {
+	f.i++ // [
+	f.depth++
+	defer func() { f.depth-- }()
+	list := []any{}
+	for {
+		if f.space(); f.i < len(f.s) && f.s[f.i] == ']' {
+			f.i++
+			return list, nil
+		}
+		v, err := f.value()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+		if err := f.separator(']'); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (f *yamlFlow) mapping() (map[string]any, error) {
+	f.i++ // {
+	f.depth++
+	defer func() { f.depth-- }()
+	m := map[string]any{}
+	for {
+		if f.space(); f.i < len(f.s) && f.s[f.i] == '}' {
+			f.i++
+			return m, nil
+		}
+		k, err := f.value()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			key = fmt.Sprint(k)
+		}
+		var v any
+		if f.space(); f.i < len(f.s) && f.s[f.i] == ':' {
+			f.i++
+			if v, err = f.value(); err != nil {
+				return nil, err
+			}
+		}
+		m[key] = v
+		if err := f.separator('}'); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// separator consumes the comma between entries, leaving the
+// closing bracket.
+func (f *yamlFlow) separator(end byte) error {
+	f.space()
+	switch {
+	case f.i == len(f.s):
+		return fmt.Errorf("missing %q; flow collections must end on their line", end)
+	case f.s[f.i] == ',':
+		f.i++
+	case f.s[f.i] != end:
+		return fmt.Errorf("unexpected %q", f.s[f.i:])
+	}
+	return nil
+}
+
+// yamlEscapes are the escape sequences of double-quoted scalars,
+// besides \u, which stand for the bytes of yamlUnescaped.
+const yamlEscapes, yamlUnescaped = "\"\\/0abtnvfre", "\"\\/\x00\a\b\t\n\v\f\r\x1b"
+
+// parseYAMLQuoted parses the quoted scalar at the start of s,
+// returning it and the number of bytes it takes up.
+func parseYAMLQuoted(s string) (string, int, error) {
+	quote := s[0]
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == quote && quote == '\'' && i+1 < len(s) && s[i+1] == '\'':
+			b.WriteByte('\'')
+			i++
+		case c == quote:
+			return b.String(), i + 1, nil
+		case c == '\\' && quote == '"' && i+1 < len(s):
+			i++
+			if s[i] == 'u' && i+5 <= len(s) {
+				r, err := strconv.ParseUint(s[i+1:i+5], 16, 32)
+				if err != nil {
+					return "", 0, fmt.Errorf("invalid escape %q", s[i-1:i+5])
+				}
+				b.WriteRune(rune(r))
+				i += 4
+			} else if k := strings.IndexByte(yamlEscapes, s[i]); k >= 0 {
+				b.WriteByte(yamlUnescaped[k])
+			} else {
+				return "", 0, fmt.Errorf("invalid escape %q", s[i-1:i+1])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, errors.New("unterminated quoted scalar")
+}
+
+// resolveYAMLScalar converts a plain scalar to null, a boolean,
+// a number or a string, as the YAML core schema does. Numbers are
+// float64, like those decoded by encoding/json.
+func resolveYAMLScalar(s string) any {
+	switch s {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	}
+	if c := s[0]; c == '-' || c == '+' || c == '.' || c >= '0' && c <= '9' {
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return float64(n)
+		}
+		// ParseFloat also takes hexadecimal, infinity and NaN
+		if f, err := strconv.ParseFloat(s, 64); err == nil && !strings.ContainsAny(s, "_xXpPiInN") {
+			return f
+		}
+	}
+	return s
+}
@@ -0,0 +1,181 @@
+package way
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		// want is the JSON of the decoded value
+		want string
+	}{
+		{name: "empty", yaml: "# nothing\n", want: `null`},
+		{
+			name: "block mapping",
+			yaml: `
+---
+openapi: 3.1.0 # version
+info:
+  title: Music
+  version: 1.0
+  x-empty:
+paths: {}
+`,
+			want: `{"openapi":"3.1.0","info":{"title":"Music","version":1,"x-empty":null},"paths":{}}`,
+		},
+		{
+			name: "scalars",
+			yaml: `
+int: 42
+negative: -7
+float: 2.5
+exp: 1e3
+yes: true
+no: FALSE
+null: ~
+hex: 0x1F
+octal: 010
+inf: .inf
+string: it's # comment
+hash: a#b
+url: http://example.com/a
+single: 'it''s # not a comment'
+double: "tab\tnew\nline \u00e9 \"q\""
+quoted number: "42"
+`,
+			want: `{"int":42,"negative":-7,"float":2.5,"exp":1000,"yes":true,"no":false,"null":null,
+				"hex":"0x1F","octal":10,"inf":".inf","string":"it's","hash":"a#b","url":"http://example.com/a",
+				"single":"it's # not a comment","double":"tab\tnew\nline é \"q\"","quoted number":"42"}`,
+		},
+		{
+			name: "quoted keys",
+			yaml: `
+'200':
+  description: OK
+"/songs/{id}": {}
+/bands/{band}: []
+`,
+			want: `{"200":{"description":"OK"},"/songs/{id}":{},"/bands/{band}":[]}`,
+		},
+		{
+			name: "sequences",
+			yaml: `
+tags:
+- music
+- songs
+required:
+  - name
+  -   band
+nested:
+  - - 1
+    - 2
+  - [3, 4]
+`,
+			want: `{"tags":["music","songs"],"required":["name","band"],"nested":[[1,2],[3,4]]}`,
+		},
+		{
+			name: "mappings in sequences",
+			yaml: `
+parameters:
+  - name: id
+    in: path
+    schema:
+      type: integer
+  - $ref: '#/components/parameters/Limit'
+  -
+    name: q
+`,
+			want: `{"parameters":[{"name":"id","in":"path","schema":{"type":"integer"}},{"$ref":"#/components/parameters/Limit"},{"name":"q"}]}`,
+		},
+		{
+			name: "flow collections",
+			yaml: `
+type: [string, "null"]
+schema: {type: object, required: [a, b], properties: {a: {type: string}, 'b c': {}}}
+enum: [1, 2.5, true, null, "x, y"]
+empty: [ ]
+`,
+			want: `{"type":["string","null"],"schema":{"type":"object","required":["a","b"],"properties":{"a":{"type":"string"},"b c":{}}},
+				"enum":[1,2.5,true,null,"x, y"],"empty":[]}`,
+		},
+		{
+			name: "block scalars",
+			yaml: `
+literal: |
+  line 1
+    indented # kept
+
+  line 3
+folded: >
+  a
+  b
+
+  c
+strip: |-
+  text
+
+keep: |+
+  text
+
+items:
+  - |
+    in a list
+last: end
+`,
+			want: `{"literal":"line 1\n  indented # kept\n\nline 3\n","folded":"a b\nc\n","strip":"text","keep":"text\n\n",
+				"items":["in a list\n"],"last":"end"}`,
+		},
+		{
+			name: "value on the next line",
+			yaml: "summary:\n  Get a song\n",
+			want: `{"summary":"Get a song"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseYAML([]byte(tt.yaml))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want any
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("parseYAML = %#v, want %#v", got, want)
+			}
+		})
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want string
+	}{
+		{name: "bad indentation", yaml: "a:\n    b: 1\n  c: 2\n", want: "line 3: unexpected indentation"},
+		{name: "duplicate key", yaml: "a: 1\na: 2\n", want: `line 2: duplicate key "a"`},
+		{name: "tab", yaml: "a:\n\tb: 1\n", want: "line 2: tabs are not allowed"},
+		{name: "anchor", yaml: "a: &x 1\n", want: "line 1: anchors, aliases and tags are not supported"},
+		{name: "alias", yaml: "a: *x\n", want: "line 1: anchors, aliases and tags are not supported"},
+		{name: "multiline flow", yaml: "a: [1,\n  2]\n", want: "line 1: missing ']'"},
+		{name: "unterminated quote", yaml: `a: "b` + "\n", want: "line 1: unterminated quoted scalar"},
+		{name: "bad escape", yaml: `a: "\q"` + "\n", want: `line 1: invalid escape "\\q"`},
+		{name: "second document", yaml: "a: 1\n---\nb: 2\n", want: "line 2: multiple documents are not supported"},
+		{name: "item in mapping", yaml: "a: 1\n- b\n", want: "line 2: unexpected content"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseYAML([]byte(tt.yaml))
+			if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+				t.Errorf("error = %v, want %s", err, tt.want)
+			}
+		})
+	}
+}